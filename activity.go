@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sync"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+// activityFade is how long the number of new messages of a topic stays
+// visible after a frame.
+const activityFade = time.Second
+
+var activityColor = color.RGBA{R: 0x6f, G: 0xa8, B: 0xe0, A: 0xff}
+
+// activityState is the render state of the activity badge of a topic.
+// activityCount are the messages received since the frame before at
+// activityAt.
+type activityState struct {
+	renderedMessages int
+	activityCount    int
+	activityAt       time.Time
+}
+
+var (
+	activityMux sync.Mutex
+	// activities are kept apart from the topics, since the tree is built
+	// while holding mux only for reading.
+	activities = make(map[*topic]*activityState)
+)
+
+// activity returns the number of messages t received between the last two
+// frames showing it, and how visible the badge showing them is, from 1
+// right after the frame to 0 after activityFade. It must only be called
+// while building the tree, which is the only place the render state of t is
+// used. The caller must hold mux for reading.
+func (t *topic) activity(now time.Time) (int, float64) {
+	activityMux.Lock()
+	defer activityMux.Unlock()
+	a := activities[t]
+	if a == nil {
+		a = &activityState{}
+		activities[t] = a
+	}
+	if n := t.messages - a.renderedMessages; n > 0 {
+		a.renderedMessages = t.messages
+		a.activityCount, a.activityAt = n, now
+	}
+	elapsed := now.Sub(a.activityAt)
+	if a.activityAt.IsZero() || elapsed >= activityFade {
+		return 0, 0
+	}
+	return a.activityCount, 1 - float64(elapsed)/float64(activityFade)
+}
+
+// forgetActivity drops the render state of t, or of all topics if t is nil.
+func forgetActivity(t *topic) {
+	activityMux.Lock()
+	defer activityMux.Unlock()
+	if t == nil {
+		activities = make(map[*topic]*activityState)
+	} else {
+		delete(activities, t)
+	}
+}
+
+// activityBadge returns w followed by the number of new messages of t, which
+// fades out.
+func (t *topic) activityBadge(w g.Widget, now time.Time) g.Widget {
+	n, fade := t.activity(now)
+	if n == 0 {
+		return w
+	}
+	badge := g.Style().SetColor(g.StyleColorText, faded(activityColor, fade)).
+		To(g.Label(fmt.Sprintf("+%d", n)))
+	return g.Row(w, badge)
+}
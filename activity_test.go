@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivity(t *testing.T) {
+	now := time.Now()
+	tp := &topic{messages: 3}
+
+	if n, fade := tp.activity(now); n != 3 || fade != 1 {
+		t.Errorf("first frame: activity = %d, %v, want 3, 1", n, fade)
+	}
+	if n, fade := tp.activity(now.Add(activityFade / 2)); n != 3 || fade != 0.5 {
+		t.Errorf("frame without messages: activity = %d, %v, want 3, 0.5", n, fade)
+	}
+	tp.messages++
+	if n, fade := tp.activity(now.Add(activityFade / 2)); n != 1 || fade != 1 {
+		t.Errorf("frame after a message: activity = %d, %v, want 1, 1", n, fade)
+	}
+	if n, _ := tp.activity(now.Add(2 * activityFade)); n != 0 {
+		t.Errorf("faded out: activity = %d, want 0", n)
+	}
+}
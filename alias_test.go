@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestLabelShowsRealName(t *testing.T) {
+	defer func() { showRealNames = false }()
+	n := &topic{name: "0x1f", alias: "Boiler"}
+	if got := n.label(); got != "Boiler" {
+		t.Errorf("label() = %q, want Boiler", got)
+	}
+	showRealNames = true
+	if got := n.label(); got != "Boiler (0x1f)" {
+		t.Errorf("label() = %q, want Boiler (0x1f)", got)
+	}
+}
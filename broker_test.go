@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 broker. It supports just
+// enough of the protocol for the tests: QoS 0 and 1 publishing, subscribing
+// with wildcards and retained messages. All messages are delivered with QoS 0.
+type testBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	sessions map[*brokerSession]bool
+	retained map[string][]byte
+	denied   map[string]bool
+}
+
+type brokerSession struct {
+	conn    net.Conn
+	wmu     sync.Mutex
+	filters map[string]bool
+}
+
+// Packet types as defined in section 2.2.1 of the MQTT 3.1.1 specification.
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+func startTestBroker() (*testBroker, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &testBroker{
+		ln:       ln,
+		sessions: make(map[*brokerSession]bool),
+		retained: make(map[string][]byte),
+		denied:   make(map[string]bool),
+	}
+	go b.serve()
+	return b, nil
+}
+
+// url returns the broker URL to connect to.
+func (b *testBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *testBroker) close() error {
+	return b.ln.Close()
+}
+
+// reset forgets all retained messages and denied filters.
+func (b *testBroker) reset() {
+	b.mu.Lock()
+	b.retained = make(map[string][]byte)
+	b.denied = make(map[string]bool)
+	b.mu.Unlock()
+}
+
+// deny makes the broker reject subscriptions to filter.
+func (b *testBroker) deny(filter string) {
+	b.mu.Lock()
+	b.denied[filter] = true
+	b.mu.Unlock()
+}
+
+// kick closes all client connections.
+func (b *testBroker) kick() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+// publish delivers a message to all subscribed clients as if it was
+// published by another client.
+func (b *testBroker) publish(topic string, payload []byte, retained bool) {
+	b.mu.Lock()
+	if retained {
+		if len(payload) == 0 {
+			delete(b.retained, topic)
+		} else {
+			b.retained[topic] = payload
+		}
+	}
+	var targets []*brokerSession
+	for s := range b.sessions {
+		for f := range s.filters {
+			if matchFilter(f, topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, s := range targets {
+		_ = s.write(packetPublish<<4, publishBody(topic, payload))
+	}
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		s := &brokerSession{conn: conn, filters: make(map[string]bool)}
+		b.mu.Lock()
+		b.sessions[s] = true
+		b.mu.Unlock()
+		go func() {
+			_ = b.handle(s)
+			b.mu.Lock()
+			delete(b.sessions, s)
+			b.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (b *testBroker) handle(s *brokerSession) error {
+	r := bufio.NewReader(s.conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+
+		switch header >> 4 {
+		case packetConnect:
+			if err := s.write(packetConnack<<4, []byte{0, 0}); err != nil {
+				return err
+			}
+		case packetPublish:
+			qos := (header >> 1) & 0x3
+			topic, rest, err := readString(body)
+			if err != nil {
+				return err
+			}
+			if qos > 0 {
+				if len(rest) < 2 {
+					return errors.New("publish without packet identifier")
+				}
+				if err := s.write(packetPuback<<4, rest[:2]); err != nil {
+					return err
+				}
+				rest = rest[2:]
+			}
+			b.publish(topic, rest, header&0x1 == 1)
+		case packetSubscribe:
+			if len(body) < 2 {
+				return errors.New("subscribe without packet identifier")
+			}
+			ack := append([]byte(nil), body[:2]...)
+			var filters []string
+			b.mu.Lock()
+			for rest := body[2:]; len(rest) > 0; {
+				var f string
+				if f, rest, err = readString(rest); err != nil || len(rest) < 1 {
+					b.mu.Unlock()
+					return errors.New("malformed subscribe")
+				}
+				if b.denied[f] {
+					ack = append(ack, 0x80)
+				} else {
+					ack = append(ack, rest[0])
+					filters = append(filters, f)
+				}
+				rest = rest[1:]
+			}
+
+			for _, f := range filters {
+				s.filters[f] = true
+			}
+			retained := make(map[string][]byte)
+			for t, p := range b.retained {
+				for _, f := range filters {
+					if matchFilter(f, t) {
+						retained[t] = p
+					}
+				}
+			}
+			b.mu.Unlock()
+
+			if err := s.write(packetSuback<<4, ack); err != nil {
+				return err
+			}
+			for t, p := range retained {
+				if err := s.write(packetPublish<<4|1, publishBody(t, p)); err != nil {
+					return err
+				}
+			}
+		case packetUnsubscribe:
+			if len(body) < 2 {
+				return errors.New("unsubscribe without packet identifier")
+			}
+			b.mu.Lock()
+			for rest := body[2:]; len(rest) > 0; {
+				var f string
+				if f, rest, err = readString(rest); err != nil {
+					b.mu.Unlock()
+					return err
+				}
+				delete(s.filters, f)
+			}
+			b.mu.Unlock()
+			if err := s.write(packetUnsuback<<4, body[:2]); err != nil {
+				return err
+			}
+		case packetPingreq:
+			if err := s.write(packetPingresp<<4, nil); err != nil {
+				return err
+			}
+		case packetDisconnect:
+			return nil
+		}
+	}
+}
+
+func (s *brokerSession) write(header byte, body []byte) error {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		pkt = append(pkt, d)
+		if n == 0 {
+			break
+		}
+	}
+	pkt = append(pkt, body...)
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, err := s.conn.Write(pkt)
+	return err
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(d&0x7f) << shift
+		if d&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func publishBody(topic string, payload []byte) []byte {
+	body := make([]byte, 2, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(body, uint16(len(topic)))
+	body = append(body, topic...)
+	return append(body, payload...)
+}
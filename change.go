@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"time"
+
+	g "github.com/AllenDang/giu"
+	"github.com/AllenDang/imgui-go"
+)
+
+// changeFlash is how long a changed value stays highlighted.
+const changeFlash = 2 * time.Second
+
+var (
+	flashColor = color.RGBA{R: 0xe0, G: 0xc0, B: 0x40, A: 0x60}
+	upColor    = color.RGBA{R: 0x4f, G: 0xc0, B: 0x4f, A: 0xff}
+	downColor  = color.RGBA{R: 0xe0, G: 0x4f, B: 0x4f, A: 0xff}
+)
+
+// recordChange starts the change flash of t if its value changed from prev.
+// Changes between two numbers also record the delta.
+func (t *topic) recordChange(prev string, hadValue bool, now time.Time) {
+	cur := t.value()
+	if !hadValue || cur == prev {
+		return
+	}
+	t.changedAt = now
+	t.hasDelta = false
+	a, errA := strconv.ParseFloat(prev, 64)
+	b, errB := strconv.ParseFloat(cur, 64)
+	if errA == nil && errB == nil {
+		t.delta, t.hasDelta = b-a, true
+	}
+}
+
+// flashing returns w preceded by the change indicator of t while its last
+// change is recent, highlighting the cell with a color that fades out.
+func (t *topic) flashing(w g.Widget, now time.Time) g.Widget {
+	elapsed := now.Sub(t.changedAt)
+	if t.changedAt.IsZero() || elapsed >= changeFlash {
+		return w
+	}
+	fade := 1 - float64(elapsed)/float64(changeFlash)
+	bg := faded(flashColor, fade)
+	cell := g.Custom(func() {
+		imgui.TableSetBgColor(imgui.TableBgTarget_CellBg, packColor(bg), -1)
+	})
+	if !t.hasDelta {
+		return g.Layout{cell, w}
+	}
+
+	arrow, c := "▲", upColor
+	if t.delta < 0 {
+		arrow, c = "▼", downColor
+	}
+	indicator := g.Style().SetColor(g.StyleColorText, faded(c, fade)).
+		To(g.Label(fmt.Sprintf("%s %+.6g", arrow, t.delta)))
+	return g.Layout{cell, g.Row(indicator, w)}
+}
+
+// faded returns c with its alpha scaled by f.
+func faded(c color.RGBA, f float64) color.RGBA {
+	c.A = uint8(float64(c.A) * f)
+	return c
+}
+
+// packColor packs c as expected by imgui.
+func packColor(c color.RGBA) uint32 {
+	return uint32(c.A)<<24 | uint32(c.B)<<16 | uint32(c.G)<<8 | uint32(c.R)
+}
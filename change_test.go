@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordChange(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		prev, cur string
+		hadValue  bool
+		changed   bool
+		hasDelta  bool
+		delta     float64
+	}{
+		{"first value", "", "1", false, false, false, 0},
+		{"unchanged", "1", "1", true, false, false, 0},
+		{"up", "1", "3.5", true, true, true, 2.5},
+		{"down", "1", "-1", true, true, true, -2},
+		{"text", "on", "off", true, true, false, 0},
+		{"number to text", "1", "off", true, true, false, 0},
+	}
+	for _, tt := range tests {
+		n := &topic{friendlyPayload: &tt.cur}
+		n.recordChange(tt.prev, tt.hadValue, now)
+		if changed := n.changedAt.Equal(now); changed != tt.changed {
+			t.Errorf("%s: changed = %v, want %v", tt.name, changed, tt.changed)
+		}
+		if n.hasDelta != tt.hasDelta || n.delta != tt.delta {
+			t.Errorf("%s: delta = %v, %g, want %v, %g", tt.name, n.hasDelta, n.delta, tt.hasDelta, tt.delta)
+		}
+	}
+}
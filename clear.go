@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var clearOnEmptyRetainedFlag = flag.Bool("clear-on-empty-retained", false, "remove topics from the tree when their retained message is deleted with an empty payload")
+
+// deletesRetained reports whether msg deletes the retained message of the
+// leaf t. Brokers usually forward deletions to subscribers without the
+// retained flag, so an empty payload replacing a retained one counts, too.
+func (t *topic) deletesRetained(msg mqtt.Message) bool {
+	if !*clearOnEmptyRetainedFlag || len(msg.Payload()) > 0 || t.children != nil {
+		return false
+	}
+	return msg.Retained() || t.last != nil && t.last.Retained()
+}
+
+// remove removes the leaf t from the tree together with the branches left
+// empty. The caller must hold mux.
+func (t *topic) remove() {
+	if t.friendlyPayload != nil {
+		delete(fuzzyTopics, t.fuzzyTerm())
+		encodingCounts[t.encoding]--
+	}
+	delete(fuzzyTerms, t)
+	delete(heldTopics, t)
+	forgetActivity(t)
+	if selected == t {
+		selected = nil
+	}
+	if compareA == t || compareB == t {
+		clearComparison()
+	}
+
+	t.addBelow(-t.messages - t.below)
+	for n := t; n.parent != nil; n = n.parent {
+		p := n.parent
+		delete(p.children, n.name)
+		if len(p.children) > 0 || p.parent == nil {
+			return
+		}
+		if p.last != nil {
+			// p is a topic of its own, it becomes a leaf again.
+			p.children = nil
+			return
+		}
+		p.addBelow(-p.messages)
+	}
+}
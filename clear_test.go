@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestClearOnEmptyRetained(t *testing.T) {
+	resetTree(t)
+	defer func(v bool) { *clearOnEmptyRetainedFlag = v }(*clearOnEmptyRetainedFlag)
+	*clearOnEmptyRetainedFlag = true
+
+	for _, m := range []exportedTopic{
+		{Topic: "a/b/retained", Payload: []byte("1"), Retained: true},
+		{Topic: "a/live", Payload: []byte("2")},
+		{Topic: "a/live"},
+		{Topic: "a/b/retained"},
+		{Topic: "c", Payload: []byte("3"), Retained: true},
+		{Topic: "c/d", Payload: []byte("4"), Retained: true},
+		{Topic: "c/d", Retained: true},
+	} {
+		defaultHandler(nil, &forwardedMessage{m})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	for _, topic := range []string{"a/b/retained", "a/b", "c/d"} {
+		if lookupLocked(topic) != nil {
+			t.Errorf("%s still in the tree", topic)
+		}
+	}
+	if live := lookupLocked("a/live"); live == nil || live.value() != emptyPayload {
+		t.Errorf("a/live = %v, want it to show %s", live, emptyPayload)
+	}
+	if c := lookupLocked("c"); c == nil || c.children != nil {
+		t.Errorf("c = %v, want a leaf", c)
+	}
+	if len(fuzzyTerms) != 2 || len(fuzzyTopics) != 2 {
+		t.Errorf("%d fuzzy terms for %d topics, want 2", len(fuzzyTerms), len(fuzzyTopics))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+
+	g "github.com/AllenDang/giu"
+	"github.com/AllenDang/imgui-go"
+)
+
+// colorNamespaces tints each top-level namespace in a distinct color.
+var colorNamespaces = true
+
+// namespace returns the top-level ancestor of t, which may be t itself.
+func (t *topic) namespace() *topic {
+	n := t
+	for n.parent != nil && n.parent.parent != nil {
+		n = n.parent
+	}
+	return n
+}
+
+// namespaceColor derives a stable, translucent row color from name, packed
+// as expected by imgui.
+func namespaceColor(name string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	hue := float64(h.Sum32()%360) / 60
+
+	// HSV to RGB with fixed saturation and value.
+	const s, v = 0.6, 0.8
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(hue, 2)-1))
+	var r, gr, b float64
+	switch int(hue) {
+	case 0:
+		r, gr = c, x
+	case 1:
+		r, gr = x, c
+	case 2:
+		gr, b = c, x
+	case 3:
+		gr, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := v - c
+	pack := func(f float64) uint32 { return uint32((f + m) * 255) }
+	const alpha = 0x40
+	return alpha<<24 | pack(b)<<16 | pack(gr)<<8 | pack(r)
+}
+
+// tinted returns a widget that builds w after tinting the current table row
+// in the color of t's tag, or else of t's namespace.
+func (t *topic) tinted(w g.Widget) g.Widget {
+	c, ok := t.tagColor()
+	if !ok && colorNamespaces {
+		c, ok = namespaceColor(t.namespace().name), true
+	}
+	if !ok {
+		if w == nil {
+			// Rows can't build nil widgets.
+			return g.Layout{}
+		}
+		return w
+	}
+	return g.Custom(func() {
+		imgui.TableSetBgColor(imgui.TableBgTarget_RowBg1, c, -1)
+		if w != nil {
+			w.Build()
+		}
+	})
+}
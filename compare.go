@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	g "github.com/AllenDang/giu"
+)
+
+// compareA and compareB are the topics marked for comparison. B is only set
+// once A is.
+var compareA, compareB *topic
+
+// markForComparison marks t as first topic to compare, or as second if only
+// the first is marked.
+func markForComparison(t *topic) {
+	if compareA == nil || compareB != nil {
+		compareA, compareB = t, nil
+	} else {
+		compareB = t
+	}
+}
+
+func clearComparison() {
+	compareA, compareB = nil, nil
+}
+
+// comparisonHeight returns the height taken by the comparison panel.
+func comparisonHeight() float32 {
+	if compareA == nil {
+		return 0
+	}
+	return 30
+}
+
+// comparisonView shows the values of the marked topics side by side with their
+// difference. The caller must hold mux.
+func comparisonView() g.Widget {
+	if compareA == nil {
+		return g.Layout{}
+	}
+
+	a := compareA.last.Topic() + " = " + compareA.value()
+	if compareB == nil {
+		return g.Row(
+			g.SmallButton("Clear comparison").OnClick(clearComparison),
+			g.Label(a+", mark another topic to compare"),
+		)
+	}
+	b := compareB.last.Topic() + " = " + compareB.value()
+	return g.Row(
+		g.SmallButton("Clear comparison").OnClick(clearComparison),
+		g.Label(a),
+		g.Label("|"),
+		g.Label(b),
+		g.Label(difference(compareA.value(), compareB.value())),
+	)
+}
+
+// difference returns the numeric difference b - a, if both are numbers.
+func difference(a, b string) string {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return ""
+	}
+	return fmt.Sprintf("| difference %g", y-x)
+}
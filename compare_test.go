@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestMarkForComparison(t *testing.T) {
+	defer clearComparison()
+	a, b, c := &topic{name: "a"}, &topic{name: "b"}, &topic{name: "c"}
+
+	markForComparison(a)
+	if compareA != a || compareB != nil {
+		t.Fatalf("after marking a: %v, %v", compareA, compareB)
+	}
+	markForComparison(b)
+	if compareA != a || compareB != b {
+		t.Fatalf("after marking b: %v, %v", compareA, compareB)
+	}
+	markForComparison(c)
+	if compareA != c || compareB != nil {
+		t.Fatalf("after marking c: %v, %v", compareA, compareB)
+	}
+}
+
+func TestDifference(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{"20.5", "21", "| difference 0.5"},
+		{"3", "-1", "| difference -4"},
+		{"3", `"on"`, ""},
+	}
+	for _, tt := range tests {
+		if got := difference(tt.a, tt.b); got != tt.want {
+			t.Errorf("difference(%s, %s) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
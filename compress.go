@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	g "github.com/AllenDang/giu"
+)
+
+// maxDecompressed is the most bytes a compressed payload is decompressed to,
+// so that small payloads can't expand to fill the memory.
+const maxDecompressed = 1 << 20
+
+// isZlib reports whether payload starts with a zlib header, that is the
+// deflate method with a valid header checksum.
+func isZlib(payload []byte) bool {
+	return len(payload) >= 2 && payload[0] == 0x78 && (uint16(payload[0])<<8|uint16(payload[1]))%31 == 0
+}
+
+// decompress returns payload decompressed if it is gzip or zlib framed. The
+// output is cut at maxDecompressed bytes, reported by truncated.
+func decompress(payload []byte) (out []byte, truncated, ok bool) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case bytes.HasPrefix(payload, []byte{0x1f, 0x8b}):
+		r, err = gzip.NewReader(bytes.NewReader(payload))
+	case isZlib(payload):
+		r, err = zlib.NewReader(bytes.NewReader(payload))
+	default:
+		return nil, false, false
+	}
+	if err != nil {
+		return nil, false, false
+	}
+	defer r.Close()
+
+	out, err = io.ReadAll(io.LimitReader(r, maxDecompressed+1))
+	if len(out) > maxDecompressed {
+		return out[:maxDecompressed], true, true
+	}
+	// Reading to the end verified the checksum.
+	if err != nil {
+		return nil, false, false
+	}
+	return out, false, true
+}
+
+// decodeCompressed decodes payload if it is gzip or zlib framed. The note
+// says that it was decompressed, and whether the output was cut.
+func decodeCompressed(payload []byte) (s string, enc encoding, note string, ok bool) {
+	out, truncated, ok := decompress(payload)
+	if !ok {
+		return "", encodingNone, "", false
+	}
+	s, enc = decodePlain(out)
+	if truncated {
+		return s, enc, fmt.Sprintf("decompressed from %d bytes, cut at %d bytes", len(payload), maxDecompressed), true
+	}
+	return s, enc, fmt.Sprintf("decompressed from %d bytes", len(payload)), true
+}
+
+// compressedBadge returns w preceded by a badge if the last payload of t was
+// decompressed for display.
+func (t *topic) compressedBadge(w g.Widget) g.Widget {
+	if t.compressed == "" {
+		return w
+	}
+	return g.Row(
+		g.Style().SetColor(g.StyleColorText, badgeColor).To(g.Label("compressed")),
+		g.Tooltip(t.compressed),
+		w,
+	)
+}
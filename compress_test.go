@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCompressed(t *testing.T) {
+	var gz, zl bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(`{"a":1}`))
+	gw.Close()
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte("21.5"))
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+		enc     encoding
+	}{
+		{"gzip", gz.Bytes(), `{"a":1}`, encodingJSON},
+		{"zlib", zl.Bytes(), "21.5", encodingNumber},
+		{"corrupt gzip", gz.Bytes()[:len(gz.Bytes())-4], "", encodingBinary},
+		{"text starting with x", []byte("x-ray"), `"x-ray"`, encodingText},
+	}
+	for _, tt := range tests {
+		got, enc := decode(tt.payload)
+		if tt.want != "" && got != tt.want || enc != tt.enc {
+			t.Errorf("%s: decode(%x) = %s, %s, want %s, %s", tt.name, tt.payload, got, encodingNames[enc], tt.want, encodingNames[tt.enc])
+		}
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(strings.Repeat("a", 2*maxDecompressed)))
+	gw.Close()
+
+	out, truncated, ok := decompress(gz.Bytes())
+	if !ok || !truncated || len(out) != maxDecompressed {
+		t.Errorf("decompress(%d bytes) = %d bytes, truncated %v, ok %v, want %d bytes, truncated", gz.Len(), len(out), truncated, ok, maxDecompressed)
+	}
+}
+
+func TestCompressedNote(t *testing.T) {
+	resetTree(t)
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("21.5"))
+	gw.Close()
+
+	defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: "a/gz", Payload: gz.Bytes()}})
+	defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: "a/plain", Payload: []byte("21.5")}})
+
+	mux.RLock()
+	defer mux.RUnlock()
+	if n := lookupLocked("a/gz"); n.value() != "21.5" || !strings.HasPrefix(n.compressed, "decompressed") {
+		t.Errorf("compressed topic = %q, note %q", n.value(), n.compressed)
+	}
+	if n := lookupLocked("a/plain"); n.compressed != "" {
+		t.Errorf("plain topic note = %q, want none", n.compressed)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/expr-lang/expr/vm"
+)
+
+var configFlag = flag.String("config", "", "config file, defaults to zapper/config.json in the user config directory")
+
+// config holds the settings read from the config file.
+var config fileConfig
+
+// fileConfig is the structure of the config file. Rules are matched against
+// topics in order, the first matching rule applies. Brokers holds rules that
+// apply only while connected to the broker with the given URL, fallbacks
+// included, before the others. Order
+// lists top-level namespaces to show first, in this order.
+type fileConfig struct {
+	Units      []unitRule      `json:"units"`
+	Aliases    []aliasRule     `json:"aliases"`
+	Transforms []transformRule `json:"transforms"`
+	Schemas    []schemaRule    `json:"schemas"`
+	Dedup      []dedupRule     `json:"dedup"`
+	Rates      []rateRule      `json:"rates"`
+	CSV        []csvRule       `json:"csv"`
+	Gauges     []gaugeRule     `json:"gauges"`
+	Order      []string        `json:"order"`
+
+	Brokers map[string]fileConfig `json:"brokers"`
+}
+
+// unitRule appends a unit to numeric values of topics matching Filter.
+type unitRule struct {
+	Filter string `json:"filter"`
+	Unit   string `json:"unit"`
+}
+
+// aliasRule displays Name instead of the last segment of topics and branches
+// matching Filter. It does not change the topic used for copying.
+type aliasRule struct {
+	Filter string `json:"filter"`
+	Name   string `json:"name"`
+}
+
+// transformRule displays only the part of JSON payloads selected by the
+// JSONPath expression Path for topics matching Filter. Alternatively or
+// afterwards, the value computed by the expression Expr is displayed, such
+// as value * 9 / 5 + 32. See https://expr-lang.org for the language.
+type transformRule struct {
+	Filter string `json:"filter"`
+	Path   string `json:"path"`
+	Expr   string `json:"expr"`
+
+	compiled *jsonPath
+	err      error
+	program  *vm.Program
+	exprErr  error
+}
+
+// schemaRule validates payloads of topics matching Filter against the JSON
+// Schema in File. Relative paths are resolved against the directory of the
+// config file.
+type schemaRule struct {
+	Filter string `json:"filter"`
+	File   string `json:"file"`
+
+	compiled *jsonSchema
+	err      error
+}
+
+// dedupRule overrides -dedup for topics matching Filter.
+type dedupRule struct {
+	Filter string `json:"filter"`
+	Dedup  bool   `json:"dedup"`
+}
+
+// rateRule overrides -max-rate for topics matching Filter.
+type rateRule struct {
+	Filter  string  `json:"filter"`
+	MaxRate float64 `json:"max_rate"`
+}
+
+// csvRule decodes delimited numeric payloads of topics matching Filter, even
+// without -csv. Delimiter defaults to a comma. If Labels are given, values
+// are shown as an object with these keys instead of an array.
+type csvRule struct {
+	Filter    string   `json:"filter"`
+	Delimiter string   `json:"delimiter"`
+	Labels    []string `json:"labels"`
+}
+
+// defaultConfigPath returns the path of the config file used if -config is
+// not given.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "zapper", "config.json"), nil
+}
+
+// loadConfig reads the config file. A missing default config file is not an
+// error.
+func loadConfig() error {
+	name := *configFlag
+	if name == "" {
+		var err error
+		if name, err = defaultConfigPath(); err != nil {
+			return nil
+		}
+		if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return fmt.Errorf("invalid config %s: %w", name, err)
+	}
+	config.useBroker(configBroker())
+	for i := range config.Transforms {
+		r := &config.Transforms[i]
+		if r.Path != "" || r.Expr == "" {
+			r.compiled, r.err = compileJSONPath(r.Path)
+		}
+		if r.Expr != "" {
+			r.program, r.exprErr = compileExpr(r.Expr)
+		}
+	}
+	for i := range config.Schemas {
+		r := &config.Schemas[i]
+		r.compiled, r.err = loadSchema(filepath.Dir(name), r.File)
+	}
+	return nil
+}
+
+// rulesBroker is the broker the rules were last loaded for by loadRulesFor.
+// It is protected by mux.
+var rulesBroker string
+
+// configBroker returns the broker whose rules apply: the one they were last
+// loaded for, or else the first one given with -broker.
+func configBroker() string {
+	if rulesBroker != "" {
+		return rulesBroker
+	}
+	if len(brokerFlags) > 0 {
+		return brokerFlags[0]
+	}
+	return defaultBroker
+}
+
+// loadRulesFor loads the rules of the config file and the color tags for
+// broker, and applies them to the topics in the tree. The caller must hold
+// mux.
+func loadRulesFor(broker string) error {
+	rulesBroker = broker
+	config = fileConfig{}
+	err := loadConfig()
+	if tagsErr := loadTags(); err == nil {
+		err = tagsErr
+	}
+	root.walk(func(t *topic) { t.applyRules() })
+	return err
+}
+
+// followBroker loads the rules for broker if zapper connected to it while
+// the rules of another broker apply, as after failing over to a fallback.
+// Config files without rules for particular brokers are left as they are.
+func followBroker(broker string) {
+	mux.Lock()
+	defer mux.Unlock()
+	if broker == configBroker() || len(config.Brokers) == 0 {
+		return
+	}
+	if err := loadRulesFor(broker); err != nil {
+		log.Println(err)
+	}
+}
+
+// useBroker puts the rules for broker ahead of the others, so that they take
+// precedence.
+func (c *fileConfig) useBroker(broker string) {
+	b, ok := c.Brokers[broker]
+	if !ok {
+		return
+	}
+	c.Units = append(b.Units, c.Units...)
+	c.Aliases = append(b.Aliases, c.Aliases...)
+	c.Transforms = append(b.Transforms, c.Transforms...)
+	c.Schemas = append(b.Schemas, c.Schemas...)
+	c.Dedup = append(b.Dedup, c.Dedup...)
+	c.Rates = append(b.Rates, c.Rates...)
+	c.CSV = append(b.CSV, c.CSV...)
+	c.Gauges = append(b.Gauges, c.Gauges...)
+	c.Order = append(b.Order, c.Order...)
+}
+
+// applyRules applies the rules of the config file to t again after they were
+// loaded for another broker, showing the last message of leaves again. The
+// caller must hold mux.
+func (t *topic) applyRules() {
+	t.alias = aliasFor(t.topicPath())
+	if t.last == nil {
+		return
+	}
+	topic := t.last.Topic()
+	t.dedup = dedupFor(topic)
+	t.maxRate = rateFor(topic)
+	t.unit = unitFor(topic)
+	t.transform = transformFor(topic)
+	t.schema = schemaFor(topic)
+	t.schemaError = ""
+
+	msg := t.last
+	if t.held != nil {
+		msg = t.held
+	}
+	t.show(msg, time.Now())
+}
+
+// namespaceRank returns the position of the top-level namespace name in the
+// configured order. Unlisted namespaces come after all listed ones.
+func namespaceRank(name string) int {
+	for i, n := range config.Order {
+		if n == name {
+			return i
+		}
+	}
+	return len(config.Order)
+}
+
+// unitFor returns the unit configured for topic, if any.
+func unitFor(topic string) string {
+	for _, r := range config.Units {
+		if matchFilter(r.Filter, topic) {
+			return r.Unit
+		}
+	}
+	return ""
+}
+
+// aliasFor returns the display name configured for the topic or branch path,
+// if any.
+func aliasFor(path string) string {
+	for _, r := range config.Aliases {
+		if matchFilter(r.Filter, path) {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// dedupFor reports whether repeated payloads on topic are ignored.
+func dedupFor(topic string) bool {
+	for _, r := range config.Dedup {
+		if matchFilter(r.Filter, topic) {
+			return r.Dedup
+		}
+	}
+	return *dedupFlag
+}
+
+// rateFor returns the maximum number of updates per second shown for topic.
+func rateFor(topic string) float64 {
+	for _, r := range config.Rates {
+		if matchFilter(r.Filter, topic) {
+			return r.MaxRate
+		}
+	}
+	return *maxRateFlag
+}
+
+// csvFor returns the rule to decode delimited numeric payloads on topic, or
+// nil if they aren't decoded.
+func csvFor(topic string) *csvRule {
+	for i, r := range config.CSV {
+		if matchFilter(r.Filter, topic) {
+			return &config.CSV[i]
+		}
+	}
+	if *csvFlag {
+		return &csvRule{}
+	}
+	return nil
+}
+
+// transformFor returns the transformation rule matching topic, if any.
+func transformFor(topic string) *transformRule {
+	for i, r := range config.Transforms {
+		if matchFilter(r.Filter, topic) {
+			return &config.Transforms[i]
+		}
+	}
+	return nil
+}
+
+// apply returns the value to display for payload. Errors are displayed
+// inline instead of the value.
+func (r *transformRule) apply(payload []byte) string {
+	if r.err != nil {
+		return fmt.Sprintf("<invalid JSONPath: %v>", r.err)
+	}
+	if r.exprErr != nil {
+		return fmt.Sprintf("<invalid expression: %v>", r.exprErr)
+	}
+	if r.compiled != nil {
+		v, err := r.compiled.apply(payload)
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		if r.program == nil {
+			return v
+		}
+		payload = []byte(v)
+	}
+	v, err := evalExpr(r.program, payload)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return v
+}
+
+func loadSchema(dir, name string) (*jsonSchema, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := compileSchema(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+// schemaFor returns the schema rule matching topic, if any.
+func schemaFor(topic string) *schemaRule {
+	for i, r := range config.Schemas {
+		if matchFilter(r.Filter, topic) {
+			return &config.Schemas[i]
+		}
+	}
+	return nil
+}
+
+// validate returns a description of why payload violates the schema, or an
+// empty string if it is valid.
+func (r *schemaRule) validate(payload []byte) string {
+	if r.err != nil {
+		return fmt.Sprintf("invalid schema: %v", r.err)
+	}
+	if err := r.compiled.validatePayload(payload); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrokerRules(t *testing.T) {
+	defer func() { config = fileConfig{} }()
+	defer func(name string, brokers brokerList) { *configFlag, brokerFlags = name, brokers }(*configFlag, brokerFlags)
+
+	name := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(name, []byte(`{
+		"aliases": [{"filter": "home/#", "name": "House"}],
+		"units": [{"filter": "home/temperature", "unit": "°C"}],
+		"brokers": {
+			"tcp://office:1883": {"aliases": [{"filter": "home/#", "name": "Office"}]}
+		}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*configFlag = name
+
+	tests := []struct {
+		broker string
+		alias  string
+	}{
+		{"tcp://office:1883", "Office"},
+		{"tcp://home:1883", "House"},
+	}
+	for _, tt := range tests {
+		config = fileConfig{}
+		brokerFlags = brokerList{tt.broker}
+		if err := loadConfig(); err != nil {
+			t.Fatal(err)
+		}
+		if got := aliasFor("home/kitchen"); got != tt.alias {
+			t.Errorf("%s: aliasFor(home/kitchen) = %q, want %q", tt.broker, got, tt.alias)
+		}
+		if got := unitFor("home/temperature"); got != "°C" {
+			t.Errorf("%s: unitFor(home/temperature) = %q, want °C", tt.broker, got)
+		}
+	}
+}
+
+func TestTransformExpr(t *testing.T) {
+	tests := []struct {
+		rule    transformRule
+		payload string
+		want    string
+	}{
+		{transformRule{Expr: "value * 9 / 5 + 32"}, "20", "68"},
+		{transformRule{Path: "$.temp", Expr: "value * 9 / 5 + 32"}, `{"temp": 100}`, "212"},
+		{transformRule{Expr: `value.state == "on" ? "running" : "stopped"`}, `{"state": "on"}`, "running"},
+		{transformRule{Expr: "upper(value)"}, "idle", "IDLE"},
+		{transformRule{Expr: "value +"}, "1", "<invalid expression: "},
+		{transformRule{Expr: "value.missing.field"}, "1", "<"},
+		{transformRule{Expr: `repeat("a", 1000000000)`}, "1", "<invalid expression: repeat is not allowed>"},
+		{transformRule{Expr: strings.Repeat("value + ", 300) + "value"}, "1", "<invalid expression: expression too large"},
+		{transformRule{Expr: "len(1..100000000)"}, "1", "<"},
+	}
+	for _, tt := range tests {
+		r := tt.rule
+		if r.Path != "" {
+			r.compiled, r.err = compileJSONPath(r.Path)
+		}
+		r.program, r.exprErr = compileExpr(r.Expr)
+		got := r.apply([]byte(tt.payload))
+		if strings.HasPrefix(tt.want, "<") && !strings.HasPrefix(got, tt.want) || !strings.HasPrefix(tt.want, "<") && got != tt.want {
+			t.Errorf("%s on %s = %s, want %s", r.Expr, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestSortNamespaces(t *testing.T) {
+	defer func() { config = fileConfig{} }()
+	config = fileConfig{
+		Order:   []string{"plant"},
+		Brokers: map[string]fileConfig{"tcp://office:1883": {Order: []string{"office", "plant"}}},
+	}
+	config.useBroker("tcp://office:1883")
+
+	names := []string{"zigbee", "plant", "home", "office", "energy"}
+	sortNamespaces(names)
+	if got, want := strings.Join(names, " "), "office plant energy home zigbee"; got != want {
+		t.Errorf("sorted namespaces = %s, want %s", got, want)
+	}
+}
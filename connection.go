@@ -0,0 +1,509 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	g "github.com/AllenDang/giu"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var (
+	brokerFlags brokerList
+	topicFlags  topicList
+	qosFlag     = flag.Int("qos", 0, "QoS for topic filters without an @qos suffix")
+)
+
+// defaultBroker is explored if no -broker is given.
+const defaultBroker = "tcp://test.mosquitto.org:1883"
+
+func init() {
+	flag.Var(&brokerFlags, "broker", "broker to explore (scheme://host:port), may be repeated to fail over to the next\n"+
+		"brokers in turn when one is unreachable (default \""+defaultBroker+"\")")
+	flag.Var(&topicFlags, "topic", "topic filter to subscribe to, may be repeated (default \"#\")\n"+
+		"append @0, @1 or @2 to subscribe with a specific QoS, e.g. sensors/#@1\n"+
+		"shared subscriptions ($share/group/filter) are passed to the broker unchanged\n"+
+		"and require a broker supporting them, e.g. any MQTT 5 broker or Mosquitto 2")
+}
+
+// brokerList is a repeatable flag of broker URLs.
+type brokerList []string
+
+func (l *brokerList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *brokerList) Set(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty broker")
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+// subscription is a topic filter with an optional QoS. A negative QoS means
+// the value of -qos is used.
+type subscription struct {
+	filter string
+	qos    int
+}
+
+// topicList is a repeatable flag of topic filters.
+type topicList []subscription
+
+func (l *topicList) String() string {
+	var s []string
+	for _, sub := range *l {
+		if sub.qos < 0 {
+			s = append(s, sub.filter)
+		} else {
+			s = append(s, fmt.Sprintf("%s@%d", sub.filter, sub.qos))
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *topicList) Set(s string) error {
+	sub := subscription{filter: s, qos: -1}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		switch q := s[i+1:]; q {
+		case "0", "1", "2":
+			sub.filter = s[:i]
+			sub.qos = int(q[0] - '0')
+		}
+	}
+	if sub.filter == "" {
+		return fmt.Errorf("empty topic filter in %q", s)
+	}
+
+	if strings.HasPrefix(sub.filter, "$share/") {
+		parts := strings.SplitN(sub.filter, "/", 3)
+		if len(parts) < 3 || parts[1] == "" || parts[2] == "" || strings.ContainsAny(parts[1], "+#") {
+			return fmt.Errorf("invalid shared subscription %q, expected $share/group/filter", sub.filter)
+		}
+	}
+	*l = append(*l, sub)
+	return nil
+}
+
+// filters returns the topic filters to subscribe to, mapped to their QoS.
+func (l topicList) filters() map[string]byte {
+	if len(l) == 0 {
+		return map[string]byte{"#": byte(*qosFlag)}
+	}
+	filters := make(map[string]byte, len(l))
+	for _, sub := range l {
+		if sub.qos < 0 {
+			filters[sub.filter] = byte(*qosFlag)
+		} else {
+			filters[sub.filter] = byte(sub.qos)
+		}
+	}
+	return filters
+}
+
+// unshare strips the $share/group/ prefix of a shared subscription. Brokers
+// deliver shared messages on their original topic, this just makes sure a
+// misbehaving one doesn't create a $share branch in the tree.
+func unshare(topic string) string {
+	if !strings.HasPrefix(topic, "$share/") {
+		return topic
+	}
+	parts := strings.SplitN(topic, "/", 3)
+	if len(parts) < 3 {
+		return topic
+	}
+	return parts[2]
+}
+
+var (
+	reconnectMinFlag = flag.Duration("reconnect-min", time.Second, "initial delay between reconnection attempts")
+	reconnectMaxFlag = flag.Duration("reconnect-max", 2*time.Minute, "maximum delay between reconnection attempts")
+)
+
+var (
+	// client is the connected client and clientConfig its configuration.
+	// They change when switching brokers and are protected by clientMux.
+	clientMux    sync.RWMutex
+	client       mqtt.Client
+	clientConfig Config
+)
+
+// currentClient returns the connected client and its configuration. The
+// client is nil if zapper doesn't connect to a broker.
+func currentClient() (mqtt.Client, Config) {
+	clientMux.RLock()
+	defer clientMux.RUnlock()
+	return client, clientConfig
+}
+
+func setClient(c mqtt.Client, cfg Config) {
+	clientMux.Lock()
+	client, clientConfig = c, cfg
+	clientMux.Unlock()
+}
+
+var (
+	statusMux   sync.RWMutex
+	statusText  string
+	reconnectAt time.Time
+
+	// attempted is the broker paho connected to last, or tried to.
+	attempted string
+
+	// denied are the topic filters the broker rejected.
+	denied []string
+
+	// reconnectNow interrupts waiting for the next reconnection attempt.
+	reconnectNow = make(chan struct{})
+
+	// connectedAt is the time the connection was last established and
+	// shortLived the number of connections in a row that were lost within
+	// shortLivedConnection.
+	connectedAt time.Time
+	shortLived  int
+)
+
+// Connections lost this soon after connecting count as short-lived. After
+// conflictThreshold of them in a row, the client ID is probably used by
+// another client and the broker drops the older connection each time.
+const (
+	shortLivedConnection = 5 * time.Second
+	conflictThreshold    = 3
+)
+
+// setConnected records that the connection was established.
+func setConnected() {
+	statusMux.Lock()
+	connectedAt = time.Now()
+	statusMux.Unlock()
+}
+
+// lostConnection records that the connection was lost and reports whether
+// this looks like a client ID conflict.
+func lostConnection() bool {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	if time.Since(connectedAt) < shortLivedConnection {
+		shortLived++
+	} else {
+		shortLived = 0
+	}
+	return shortLived >= conflictThreshold
+}
+
+// connectedSince returns when the connection was last established.
+func connectedSince() time.Time {
+	statusMux.RLock()
+	defer statusMux.RUnlock()
+	return connectedAt
+}
+
+// connectedBroker returns the broker the client connected to, which is one
+// of the failover brokers if the first one was unreachable.
+func connectedBroker() string {
+	statusMux.RLock()
+	defer statusMux.RUnlock()
+	return attempted
+}
+
+// setStatus sets the connection status shown in the GUI.
+func setStatus(format string, a ...interface{}) {
+	statusMux.Lock()
+	statusText = fmt.Sprintf(format, a...)
+	reconnectAt = time.Time{}
+	statusMux.Unlock()
+	refresh()
+}
+
+// status returns the connection status shown in the GUI.
+func status() string {
+	statusMux.RLock()
+	defer statusMux.RUnlock()
+	if !reconnectAt.IsZero() {
+		return fmt.Sprintf("%s, reconnecting in %s", statusText, time.Until(reconnectAt).Round(time.Second))
+	}
+	return statusText
+}
+
+// waitingToReconnect reports whether the connection was lost and the next
+// reconnection attempt is pending.
+func waitingToReconnect() bool {
+	statusMux.RLock()
+	defer statusMux.RUnlock()
+	return !reconnectAt.IsZero()
+}
+
+// triggerReconnect skips the remaining delay before the next reconnection
+// attempt, if one is pending.
+func triggerReconnect() {
+	select {
+	case reconnectNow <- struct{}{}:
+	default:
+	}
+}
+
+// refresh redraws the GUI if it is running.
+func refresh() {
+	if giuStarted {
+		g.Update()
+	}
+}
+
+// backoff returns the delay before the next reconnection attempt. It doubles
+// the previous delay up to max and randomizes the second half of it to keep
+// many clients from reconnecting at the same time.
+func backoff(prev, min, max time.Duration) time.Duration {
+	d := prev * 2
+	if d < min {
+		d = min
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Config configures the connection to the broker.
+type Config struct {
+	// Broker is the URL of the broker (scheme://host:port). Fallbacks are
+	// tried in turn if it is unreachable.
+	Broker    string
+	Fallbacks []string
+	ClientID  string
+	Username  string
+	Password  string
+
+	// Subscriptions maps the topic filters to subscribe to to their QoS.
+	Subscriptions map[string]byte
+
+	// TLSServerName overrides the server name used for SNI and certificate
+	// verification. TLSALPN lists the ALPN protocols to offer. Both require
+	// a TLS broker scheme.
+	TLSServerName string
+	TLSALPN       []string
+
+	// PKCS12 is the path of a PKCS#12 file with the client certificate to
+	// authenticate with, PKCS12Password its password.
+	PKCS12         string
+	PKCS12Password string
+
+	// CertFile and KeyFile are the paths of PEM files with a client
+	// certificate and its private key, which may be encrypted with
+	// KeyPassword.
+	CertFile    string
+	KeyFile     string
+	KeyPassword string
+
+	// Proxy is the URL of a SOCKS5 or HTTP proxy to connect through.
+	Proxy string
+
+	// ReconnectMin and ReconnectMax bound the delay between reconnection
+	// attempts after the connection was lost.
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+}
+
+// Connect connects to the broker and subscribes to the configured topic
+// filters. Received messages are added to the tree. If the connection is
+// lost later on, Connect's client reconnects on its own.
+func Connect(cfg Config) (mqtt.Client, error) {
+	opts := mqtt.NewClientOptions().AddBroker(cfg.Broker).SetClientID(cfg.ClientID)
+	for _, b := range cfg.Fallbacks {
+		opts.AddBroker(b)
+	}
+	opts.SetConnectionAttemptHandler(func(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+		statusMux.Lock()
+		attempted = broker.String()
+		statusMux.Unlock()
+		return tlsCfg
+	})
+	opts.SetKeepAlive(2 * time.Second)
+	opts.SetPingTimeout(2 * time.Second)
+	opts.SetDefaultPublishHandler(defaultHandler)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(false)
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		log.Println("connection lost:", err)
+		go reconnect(c, cfg, err)
+	})
+	if cfg.Username != "" {
+		opts.SetUsername(cfg.Username)
+	}
+	if cfg.Password != "" {
+		opts.SetPassword(cfg.Password)
+	}
+
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg != nil {
+		opts.SetTLSConfig(tlsCfg)
+	}
+	if cfg.Proxy != "" {
+		u, err := parseProxy(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if err := setProxy(opts, u, cfg.Broker); err != nil {
+			return nil, err
+		}
+	}
+
+	c := mqtt.NewClient(opts)
+	if t := c.Connect(); t.Wait() && t.Error() != nil {
+		return nil, t.Error()
+	}
+	// The rules must be those of the broker connected to before its
+	// messages arrive.
+	followBroker(connectedBroker())
+
+	if err := subscribe(c, cfg); err != nil {
+		c.Disconnect(0)
+		return nil, err
+	}
+	setConnected()
+	return c, nil
+}
+
+// reconnect tries to connect c until it succeeds, waiting with exponential
+// backoff in between attempts.
+func reconnect(c mqtt.Client, cfg Config, reason error) {
+	var hint string
+	if lostConnection() {
+		// Keep the hint while connected, the connection won't last long.
+		hint = fmt.Sprintf(" (client ID conflict? %s keeps getting disconnected right after connecting)", cfg.ClientID)
+	}
+
+	gen := atomic.LoadUint64(&switches)
+	lostAt := time.Now()
+	var delay time.Duration
+	for {
+		delay = backoff(delay, cfg.ReconnectMin, cfg.ReconnectMax)
+
+		statusMux.Lock()
+		statusText = fmt.Sprintf("connection lost: %v%s", reason, hint)
+		reconnectAt = time.Now().Add(delay)
+		statusMux.Unlock()
+		refresh()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-reconnectNow:
+			timer.Stop()
+			delay = 0
+		}
+
+		if cur, _ := currentClient(); cur != nil && cur != c || atomic.LoadUint64(&switches) != gen {
+			// Switched to another broker in the meantime.
+			return
+		}
+		setStatus("reconnecting")
+		if t := c.Connect(); t.Wait() && t.Error() != nil {
+			log.Println("reconnect failed:", t.Error())
+			reason = t.Error()
+			continue
+		}
+		followBroker(connectedBroker())
+		// The session is clean, so the broker forgot the subscriptions
+		// along with the connection.
+		if err := subscribe(c, cfg); err != nil {
+			log.Println("subscribe failed:", err)
+			reason = err
+			c.Disconnect(0)
+			continue
+		}
+		log.Printf("reconnected and subscribed to %d filters again, messages published in the last %s were missed unless retained",
+			len(activeSubscriptions(cfg)), time.Since(lostAt).Round(time.Second))
+		setConnected()
+		broker := connectedBroker()
+		setStatus("connected to %s%s", broker, hint)
+		if hint != "" {
+			time.AfterFunc(shortLivedConnection, func() {
+				if c.IsConnectionOpen() && status() == "connected to "+broker+hint {
+					setStatus("connected to %s", broker)
+				}
+			})
+		}
+		return
+	}
+}
+
+// resubscribe unsubscribes from and subscribes to all topic filters again,
+// which makes the broker send its retained messages once more.
+func resubscribe(c mqtt.Client, cfg Config) error {
+	subs := activeSubscriptions(cfg)
+	filters := make([]string, 0, len(subs))
+	for f := range subs {
+		filters = append(filters, f)
+	}
+	if t := c.Unsubscribe(filters...); t.Wait() && t.Error() != nil {
+		return t.Error()
+	}
+	return subscribe(c, cfg)
+}
+
+func subscribe(c mqtt.Client, cfg Config) error {
+	t := c.SubscribeMultiple(activeSubscriptions(cfg), nil)
+	t.Wait()
+	if t.Error() == nil {
+		checkSubscriptions(t)
+	}
+	return t.Error()
+}
+
+// subscriptionFailure is the return code of SUBACK for a rejected filter.
+const subscriptionFailure = 0x80
+
+// checkSubscriptions logs and records the filters the broker rejected for
+// the status line, and with -diagnose the QoS granted for the others. Brokers reject filters the
+// client isn't authorized to subscribe to.
+func checkSubscriptions(t mqtt.Token) {
+	st, ok := t.(*mqtt.SubscribeToken)
+	if !ok {
+		return
+	}
+	result := st.Result()
+	filters := make([]string, 0, len(result))
+	for f := range result {
+		filters = append(filters, f)
+	}
+	sort.Strings(filters)
+
+	var rejected []string
+	for _, f := range filters {
+		if q := result[f]; q == subscriptionFailure && f == uptimeTopic && uptimeAdded {
+			log.Printf("subscription to %s rejected by the broker, the uptime is not shown", f)
+		} else if q == subscriptionFailure {
+			log.Printf("subscription to %s rejected by the broker", f)
+			rejected = append(rejected, f)
+		} else {
+			diag("subscribed to %s with QoS %d", f, q)
+		}
+	}
+
+	statusMux.Lock()
+	denied = rejected
+	statusMux.Unlock()
+	refresh()
+}
+
+// deniedFilters returns the topic filters the broker rejected when
+// subscribing last.
+func deniedFilters() []string {
+	statusMux.RLock()
+	defer statusMux.RUnlock()
+	return denied
+}
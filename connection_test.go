@@ -0,0 +1,612 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var broker *testBroker
+
+func TestMain(m *testing.M) {
+	var err error
+	broker, err = startTestBroker()
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	broker.close()
+	os.Exit(code)
+}
+
+// resetTree clears the tree and the retained messages of the test broker.
+func resetTree(t *testing.T) {
+	t.Helper()
+	clearTree(false)
+	broker.reset()
+}
+
+// lookup returns the node at topic or nil if it doesn't exist.
+func lookup(topic string) *topic {
+	mux.RLock()
+	defer mux.RUnlock()
+	return lookupLocked(topic)
+}
+
+// lookupLocked is like lookup, but the caller must hold mux.
+func lookupLocked(topic string) *topic {
+	t := &root
+	for _, name := range strings.Split(topic, "/") {
+		t = t.children[name]
+		if t == nil {
+			return nil
+		}
+	}
+	return t
+}
+
+// waitFor waits until topic carries a value and returns it.
+func waitFor(t *testing.T, topic string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if n := lookup(topic); n != nil {
+			mux.RLock()
+			p := n.friendlyPayload
+			mux.RUnlock()
+			if p != nil {
+				return *p
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no message received on %s", topic)
+	return ""
+}
+
+func testConfig() Config {
+	return Config{
+		Broker:        broker.url(),
+		ClientID:      "zapper-test",
+		Subscriptions: map[string]byte{"#": 0},
+		ReconnectMin:  10 * time.Millisecond,
+		ReconnectMax:  100 * time.Millisecond,
+	}
+}
+
+func connectTest(t *testing.T) {
+	t.Helper()
+	c, err := Connect(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+}
+
+func TestConnectReceivesMessages(t *testing.T) {
+	resetTree(t)
+	connectTest(t)
+
+	broker.publish("home/livingroom/temperature", []byte("21.5"), false)
+	broker.publish("home/livingroom/humidity", []byte("40"), false)
+	broker.publish("home/kitchen/light", []byte("on"), false)
+
+	if v := waitFor(t, "home/livingroom/temperature"); v != "21.5" {
+		t.Errorf("temperature = %s, want 21.5", v)
+	}
+	if v := waitFor(t, "home/livingroom/humidity"); v != "40" {
+		t.Errorf("humidity = %s, want 40", v)
+	}
+	if v := waitFor(t, "home/kitchen/light"); v != `"on"` {
+		t.Errorf("light = %s, want \"on\"", v)
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	if n := len(root.children["home"].children); n != 2 {
+		t.Errorf("home has %d children, want 2", n)
+	}
+}
+
+func TestConnectReceivesRetainedMessages(t *testing.T) {
+	resetTree(t)
+	broker.publish("config/device", []byte(`{"interval":10}`), true)
+	connectTest(t)
+
+	if v := waitFor(t, "config/device"); v != `{"interval":10}` {
+		t.Errorf("config = %s, want {\"interval\":10}", v)
+	}
+	if n := lookup("config/device"); !n.last.Retained() {
+		t.Error("message not marked as retained")
+	}
+}
+
+func TestConnectUpdatesValue(t *testing.T) {
+	resetTree(t)
+	connectTest(t)
+
+	broker.publish("counter", []byte("1"), false)
+	waitFor(t, "counter")
+	broker.publish("counter", []byte("2"), false)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for waitFor(t, "counter") != "2" {
+		if time.Now().After(deadline) {
+			t.Fatal("value not updated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	if len(fuzzyTopics) != 1 {
+		t.Errorf("%d fuzzy terms, want 1", len(fuzzyTopics))
+	}
+}
+
+func TestConnectSubscribesToFilters(t *testing.T) {
+	resetTree(t)
+	cfg := testConfig()
+	cfg.Subscriptions = map[string]byte{"sensors/#": 1, "alarms/+": 0}
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+
+	broker.publish("other", []byte("x"), false)
+	broker.publish("alarms/fire/east", []byte("x"), false)
+	broker.publish("alarms/fire", []byte("1"), false)
+	broker.publish("sensors/a/b", []byte("2"), false)
+	waitFor(t, "alarms/fire")
+	waitFor(t, "sensors/a/b")
+
+	if lookup("other") != nil {
+		t.Error("received message on unsubscribed topic other")
+	}
+	if lookup("alarms/fire/east") != nil {
+		t.Error("received message on unsubscribed topic alarms/fire/east")
+	}
+}
+
+func TestConnectRejectsTLSOptionsWithoutTLS(t *testing.T) {
+	cfg := testConfig()
+	cfg.TLSServerName = "example.com"
+	if _, err := Connect(cfg); err == nil {
+		t.Error("expected error for TLS server name with tcp scheme")
+	}
+}
+
+func TestReconnectNow(t *testing.T) {
+	resetTree(t)
+	cfg := testConfig()
+	cfg.ReconnectMin = time.Hour
+	cfg.ReconnectMax = time.Hour
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+
+	broker.kick()
+	deadline := time.Now().Add(2 * time.Second)
+	for !waitingToReconnect() {
+		if time.Now().After(deadline) {
+			t.Fatal("connection loss not detected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	triggerReconnect()
+	for !c.IsConnectionOpen() || waitingToReconnect() {
+		if time.Now().After(deadline) {
+			t.Fatal("not reconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	broker.publish("after/reconnect", []byte("1"), false)
+	waitFor(t, "after/reconnect")
+}
+
+func TestClearTreeReloadsRetained(t *testing.T) {
+	resetTree(t)
+	broker.publish("retained", []byte("1"), true)
+	cfg := testConfig()
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+	broker.publish("live", []byte("1"), false)
+	waitFor(t, "retained")
+	waitFor(t, "live")
+
+	client, clientConfig = c, cfg
+	defer func() { client = nil }()
+	clearTree(true)
+
+	waitFor(t, "retained")
+	if lookup("live") != nil {
+		t.Error("live topic not cleared")
+	}
+}
+
+func TestDedupIgnoresRepeatedPayloads(t *testing.T) {
+	resetTree(t)
+	*dedupFlag = true
+	defer func() { *dedupFlag = false }()
+	connectTest(t)
+
+	broker.publish("repeated", []byte("1"), false)
+	broker.publish("repeated", []byte("1"), false)
+	broker.publish("repeated", []byte("2"), false)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for waitFor(t, "repeated") != "2" {
+		if time.Now().After(deadline) {
+			t.Fatal("value not updated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	if n := lookupLocked("repeated").duplicates; n != 1 {
+		t.Errorf("%d duplicates, want 1", n)
+	}
+}
+
+func TestNumericStats(t *testing.T) {
+	resetTree(t)
+	connectTest(t)
+
+	for _, v := range []string{"4", "-2", "1"} {
+		broker.publish("sensor", []byte(v), false)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for waitFor(t, "sensor") != "1" {
+		if time.Now().After(deadline) {
+			t.Fatal("value not updated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	s := lookupLocked("sensor").numbers
+	if s.count != 3 || s.min != -2 || s.max != 4 || s.avg() != 1 {
+		t.Errorf("stats = %+v, avg %g, want 3 values from -2 to 4, avg 1", s, s.avg())
+	}
+}
+
+func TestClientIDConflictHint(t *testing.T) {
+	resetTree(t)
+	cfg := testConfig()
+	cfg.ReconnectMin = time.Millisecond
+	cfg.ReconnectMax = time.Millisecond
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+	defer func() {
+		statusMux.Lock()
+		shortLived = 0
+		statusMux.Unlock()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(status(), "client ID conflict") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no conflict hint, status %q", status())
+		}
+		if c.IsConnectionOpen() {
+			broker.kick()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMaxRateHoldsBackUpdates(t *testing.T) {
+	resetTree(t)
+	*maxRateFlag = 1
+	defer func() { *maxRateFlag = 0 }()
+	connectTest(t)
+
+	broker.publish("fast", []byte("1"), false)
+	waitFor(t, "fast")
+	broker.publish("fast", []byte("2"), false)
+	broker.publish("fast", []byte("3"), false)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mux.RLock()
+		n := lookupLocked("fast").numbers.count
+		mux.RUnlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d values counted, want 3", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := waitFor(t, "fast"); v != "1" {
+		t.Errorf("fast = %s before the rate limit passed, want 1", v)
+	}
+
+	mux.Lock()
+	lookupLocked("fast").shownAt = time.Now().Add(-time.Second)
+	mux.Unlock()
+	showHeld()
+	if v := waitFor(t, "fast"); v != "3" {
+		t.Errorf("fast = %s after the rate limit passed, want 3", v)
+	}
+}
+
+func TestIsolateSubtree(t *testing.T) {
+	resetTree(t)
+	cfg := testConfig()
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+	client, clientConfig = c, cfg
+	defer func() { client = nil }()
+
+	broker.publish("a/x", []byte("1"), false)
+	broker.publish("b/y", []byte("1"), false)
+	waitFor(t, "a/x")
+	waitFor(t, "b/y")
+
+	isolate(lookup("a"), true)
+	if lookup("b") != nil {
+		t.Error("b not cleared")
+	}
+	if got := isolated(); got != "a/#" {
+		t.Errorf("isolated() = %q, want a/#", got)
+	}
+	broker.publish("b/z", []byte("1"), false)
+	broker.publish("a/z", []byte("1"), false)
+	waitFor(t, "a/z")
+	if lookup("b/z") != nil {
+		t.Error("received message outside of isolated subtree")
+	}
+
+	unisolate()
+	if got := isolated(); got != "" {
+		t.Errorf("isolated() = %q after unisolate", got)
+	}
+	broker.publish("b/z", []byte("2"), false)
+	if got := waitFor(t, "b/z"); got != "2" {
+		t.Errorf("b/z = %q, want 2", got)
+	}
+}
+
+func TestConnectFailsOverToFallbackBroker(t *testing.T) {
+	resetTree(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "tcp://" + ln.Addr().String()
+	ln.Close()
+
+	// The rules for the fallback apply once connected to it.
+	defer func(name string, b brokerList) {
+		*configFlag, brokerFlags, config, rulesBroker = name, b, fileConfig{}, ""
+	}(*configFlag, brokerFlags)
+	*configFlag = filepath.Join(t.TempDir(), "config.json")
+	rules := fmt.Sprintf(`{"brokers": {%q: {"aliases": [{"filter": "failover", "name": "Backup"}]}}}`, broker.url())
+	if err := os.WriteFile(*configFlag, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	brokerFlags = brokerList{unreachable}
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.Broker, cfg.Fallbacks = unreachable, []string{broker.url()}
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+
+	if got := connectedBroker(); got != broker.url() {
+		t.Errorf("connectedBroker() = %s, want %s", got, broker.url())
+	}
+	broker.publish("failover", []byte("1"), false)
+	waitFor(t, "failover")
+	mux.RLock()
+	defer mux.RUnlock()
+	if got := lookupLocked("failover").alias; got != "Backup" {
+		t.Errorf("alias on the fallback = %q, want Backup", got)
+	}
+}
+
+func TestDeniedSubscriptions(t *testing.T) {
+	resetTree(t)
+	broker.deny("secret/#")
+	broker.deny(uptimeTopic)
+	defer broker.reset()
+	defer func(v bool) { uptimeAdded = v }(uptimeAdded)
+	cfg := testConfig()
+	cfg.Subscriptions = withUptime(map[string]byte{"secret/#": 0, "public/#": 0})
+	c, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect(0)
+
+	if got := deniedFilters(); len(got) != 1 || got[0] != "secret/#" {
+		t.Errorf("deniedFilters() = %v, want [secret/#]", got)
+	}
+	broker.publish("secret/x", []byte("1"), false)
+	broker.publish("public/x", []byte("1"), false)
+	waitFor(t, "public/x")
+	if lookup("secret/x") != nil {
+		t.Error("received message on denied filter")
+	}
+}
+
+func TestSwitchBroker(t *testing.T) {
+	resetTree(t)
+	other, err := startTestBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.close()
+	defer func(b brokerList) { brokerFlags = b }(brokerFlags)
+	defer func(name string) { *configFlag, config, rulesBroker = name, fileConfig{}, "" }(*configFlag)
+	*configFlag = filepath.Join(t.TempDir(), "config.json")
+	rules := fmt.Sprintf(`{"brokers": {%q: {"aliases": [{"filter": "new", "name": "Fresh"}]}}}`, broker.url())
+	if err := os.WriteFile(*configFlag, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Connect(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClient(c, testConfig())
+	defer func() {
+		if c, _ := currentClient(); c != nil {
+			c.Disconnect(0)
+		}
+		setClient(nil, Config{})
+	}()
+	broker.publish("old", []byte("1"), false)
+	waitFor(t, "old")
+
+	switchBroker(other.url(), false)
+	if got := connectedBroker(); got != other.url() {
+		t.Errorf("connectedBroker() = %s, want %s", got, other.url())
+	}
+	if lookup("old") != nil {
+		t.Error("topic of the previous broker still in the tree")
+	}
+	other.publish("new", []byte("2"), false)
+	waitFor(t, "new")
+
+	// Topics kept in the tree follow the rules of the new broker.
+	switchBroker(broker.url(), true)
+	mux.RLock()
+	if got := lookupLocked("new").alias; got != "Fresh" {
+		t.Errorf("alias of kept topic = %q, want Fresh", got)
+	}
+	mux.RUnlock()
+
+	closed, err := startTestBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.close()
+	switchBroker(closed.url(), true)
+	if c, _ := currentClient(); c != nil {
+		t.Error("still using a client after failing to switch")
+	}
+	if got := status(); !strings.HasPrefix(got, "disconnected") {
+		t.Errorf("status() = %q, want disconnected", got)
+	}
+
+	// Another broker can be tried after a failure, which restarts the idle
+	// timeout.
+	atomic.StoreInt32(&idleDisconnected, 1)
+	touchIdle(time.Now().Add(-time.Hour))
+	switchBroker(other.url(), true)
+	if got := connectedBroker(); got != other.url() {
+		t.Errorf("connectedBroker() = %s, want %s", got, other.url())
+	}
+	if atomic.LoadInt32(&idleDisconnected) != 0 || idleFor(time.Now()) > time.Minute {
+		t.Error("idle state of the previous connection kept")
+	}
+	mux.RLock()
+	if got := lookupLocked("new").alias; got != "" {
+		t.Errorf("alias of kept topic on another broker = %q, want none", got)
+	}
+	mux.RUnlock()
+}
+
+func TestLazyNamespaces(t *testing.T) {
+	resetTree(t)
+	defer func(v int) { *lazyFlag, loadedNamespaces = v, make(map[string]bool) }(*lazyFlag)
+	*lazyFlag = 2
+
+	c, err := Connect(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClient(c, testConfig())
+	defer func() {
+		c.Disconnect(0)
+		setClient(nil, Config{})
+	}()
+
+	broker.publish("ns/deep/topic", []byte("1"), false)
+	broker.publish("ns/shallow", []byte("2"), false)
+	waitFor(t, "ns/shallow")
+	if lookup("ns/deep/topic") != nil {
+		t.Fatal("deep topic received before loading its namespace")
+	}
+
+	setNamespaceLoaded("ns/#", true)
+	broker.publish("ns/deep/topic", []byte("3"), false)
+	waitFor(t, "ns/deep/topic")
+}
+
+func TestTopicListFilters(t *testing.T) {
+	defer func(q int) { *qosFlag = q }(*qosFlag)
+	*qosFlag = 1
+
+	tests := []struct {
+		flags []string
+		want  map[string]byte
+		err   bool
+	}{
+		{nil, map[string]byte{"#": 1}, false},
+		{[]string{"a/#"}, map[string]byte{"a/#": 1}, false},
+		{[]string{"a/#@2", "b/+@0"}, map[string]byte{"a/#": 2, "b/+": 0}, false},
+		{[]string{"user@host/#"}, map[string]byte{"user@host/#": 1}, false},
+		{[]string{"a@3"}, map[string]byte{"a@3": 1}, false},
+		{[]string{"a@"}, map[string]byte{"a@": 1}, false},
+		{[]string{"a@x@1"}, map[string]byte{"a@x": 1}, false},
+		{[]string{"$share/g/a/#@2"}, map[string]byte{"$share/g/a/#": 2}, false},
+		{[]string{"$share/g/a/#"}, map[string]byte{"$share/g/a/#": 1}, false},
+		{[]string{"@1"}, nil, true},
+		{[]string{"$share/g@2"}, nil, true},
+		{[]string{"$share//a@1"}, nil, true},
+		{[]string{"$share/g+/a"}, nil, true},
+	}
+	for _, tt := range tests {
+		var l topicList
+		var err error
+		for _, f := range tt.flags {
+			if err = l.Set(f); err != nil {
+				break
+			}
+		}
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: no error", tt.flags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.flags, err)
+			continue
+		}
+		if got := l.filters(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: filters() = %v, want %v", tt.flags, got, tt.want)
+		}
+	}
+}
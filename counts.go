@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	g "github.com/AllenDang/giu"
+)
+
+// messageCountModes are the ways of showing the number of messages of each
+// topic next to its last seen time.
+var messageCountModes = []string{"off", "absolute", "share"}
+
+var messageCountMode int32
+
+// countsCombo switches how message counts are shown.
+func countsCombo() g.Widget {
+	return g.Combo("Counts", messageCountModes[messageCountMode], messageCountModes, &messageCountMode).Size(90)
+}
+
+// addBelow adds n to the numbers of messages below the ancestors of t. The
+// caller must hold mux.
+func (t *topic) addBelow(n int) {
+	for p := t.parent; p != nil; p = p.parent {
+		p.below += n
+	}
+}
+
+// formatShare formats n of total messages as a percentage.
+func formatShare(n, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+// withCount returns w followed by the message count of the leaf t in the
+// selected mode.
+func (t *topic) withCount(w g.Widget) g.Widget {
+	var s string
+	switch messageCountModes[messageCountMode] {
+	case "absolute":
+		s = fmt.Sprintf("%d msgs", t.messages)
+	case "share":
+		s = formatShare(t.messages, t.parent.messages+t.parent.below)
+	}
+	if s == "" {
+		return w
+	}
+	return g.Row(w, g.Style().SetColor(g.StyleColorText, badgeColor).To(g.Label(s)))
+}
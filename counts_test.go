@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCountMessages(t *testing.T) {
+	resetTree(t)
+	for _, topic := range []string{"a/x", "a/x", "a/x", "a/y", "a/z/deep", "b"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if root.below != 6 {
+		t.Errorf("total = %d, want 6", root.below)
+	}
+	a := lookupLocked("a")
+	if a.below != 5 {
+		t.Errorf("messages below a = %d, want 5", a.below)
+	}
+	if got := formatShare(lookupLocked("a/x").messages, a.messages+a.below); got != "60.0%" {
+		t.Errorf("share of a/x = %s, want 60.0%%", got)
+	}
+	if got := formatShare(0, 0); got != "" {
+		t.Errorf("share of nothing = %q, want none", got)
+	}
+
+	lookupLocked("a/z/deep").remove()
+	lookupLocked("a/x").remove()
+	if a.below != 1 || root.below != 2 {
+		t.Errorf("after removing, messages below a = %d, total = %d, want 1, 2", a.below, root.below)
+	}
+
+	pruneTo(lookupLocked("a/y"))
+	if root.below != 1 {
+		t.Errorf("total after pruning = %d, want 1", root.below)
+	}
+}
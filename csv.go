@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var csvFlag = flag.Bool("csv", false, "decode delimited numeric payloads such as 12.3,45.6,78.9 as arrays, see also the csv rules of the config file")
+
+// decodeCSV decodes a payload of at least two numbers separated by the
+// delimiter of r into a JSON array, or an object keyed by the labels of r.
+// Values without a label are keyed by their index.
+func decodeCSV(payload []byte, r *csvRule) (string, bool) {
+	delim := r.Delimiter
+	if delim == "" {
+		delim = ","
+	}
+	fields := strings.Split(strings.TrimSpace(string(payload)), delim)
+	if len(fields) < 2 {
+		return "", false
+	}
+
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		values[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	if len(r.Labels) == 0 {
+		return "[" + strings.Join(values, ",") + "]", true
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		label := strconv.Itoa(i)
+		if i < len(r.Labels) {
+			label = r.Labels[i]
+		}
+		key, _ := json.Marshal(label)
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.WriteString(v)
+	}
+	b.WriteByte('}')
+	return b.String(), true
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestDecodeCSV(t *testing.T) {
+	tests := []struct {
+		payload string
+		rule    csvRule
+		want    string
+		ok      bool
+	}{
+		{"12.3,45.6,78.9", csvRule{}, "[12.3,45.6,78.9]", true},
+		{"12.3, 45.6, 78.9\n", csvRule{}, "[12.3,45.6,78.9]", true},
+		{"12.3,45.6,78.9", csvRule{Labels: []string{"x", "y"}}, `{"x":12.3,"y":45.6,"2":78.9}`, true},
+		{"1;-2", csvRule{Delimiter: ";"}, "[1,-2]", true},
+		{"1,2", csvRule{Delimiter: ";"}, "", false},
+		{"12.3", csvRule{}, "", false},
+		{"1,two,3", csvRule{}, "", false},
+		{"1,NaN", csvRule{}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := decodeCSV([]byte(tt.payload), &tt.rule)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("decodeCSV(%q, %+v) = %s, %t, want %s, %t", tt.payload, tt.rule, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDecodeMessageCSVRule(t *testing.T) {
+	defer func() { config = fileConfig{} }()
+	config = fileConfig{CSV: []csvRule{{Filter: "sensors/+/xyz", Labels: []string{"x", "y", "z"}}}}
+
+	msg := &forwardedMessage{exportedTopic{Topic: "sensors/a/xyz", Payload: []byte("12.3,45.6,78.9")}}
+	if got, enc, _ := decodeMessage(msg); got != `{"x":12.3,"y":45.6,"z":78.9}` || enc != encodingCSV {
+		t.Errorf("decodeMessage() = %s, %s", got, encodingNames[enc])
+	}
+	msg = &forwardedMessage{exportedTopic{Topic: "other", Payload: []byte("12.3,45.6,78.9")}}
+	if _, enc, _ := decodeMessage(msg); enc != encodingText {
+		t.Errorf("decodeMessage() on other topic encoding = %s, want text", encodingNames[enc])
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	g "github.com/AllenDang/giu"
+)
+
+// sizeBuckets is the number of payload size buckets kept per topic. Bucket 0
+// counts empty payloads, bucket i counts payloads of less than 2^i bytes that
+// did not fit into bucket i-1. The last bucket counts everything larger.
+const sizeBuckets = 25
+
+// invalidColor highlights payloads violating their schema.
+var invalidColor = color.RGBA{R: 0xe0, G: 0x4f, B: 0x4f, A: 0xff}
+
+// selected is the topic shown in the detail view, if any.
+var selected *topic
+
+func sizeBucket(n int) int {
+	b := 0
+	for n > 0 && b < sizeBuckets-1 {
+		n >>= 1
+		b++
+	}
+	return b
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%dK", n>>10)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+// numericStats tracks the range of the numeric values of a topic.
+type numericStats struct {
+	count         int
+	min, max, sum float64
+}
+
+func (s *numericStats) add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.sum += v
+	s.count++
+}
+
+func (s *numericStats) avg() float64 {
+	return s.sum / float64(s.count)
+}
+
+// detailView renders the selected topic. The caller must hold mux.
+func detailView() g.Widget {
+	t := selected
+	if t == nil || t.last == nil {
+		return g.Layout{}
+	}
+
+	return g.Layout{
+		g.Row(
+			g.SmallButton("Close").OnClick(func() { selected = nil }),
+			g.Label(t.last.Topic()),
+		),
+		g.Row(
+			g.Labelf("%d bytes, QoS %d, retained %t", len(t.last.Payload()), t.last.Qos(), t.last.Retained()),
+			g.SmallButton("Copy payload").OnClick(func() { g.Context.GetPlatform().SetClipboard(string(t.last.Payload())) }),
+			g.SmallButton("Copy hexdump").OnClick(func() { g.Context.GetPlatform().SetClipboard(hexdump(t.last.Payload())) }),
+			g.Label(entropyHint(t.last.Payload())),
+		),
+		g.Condition(t.numbers.count > 0, g.Layout{
+			g.Row(
+				g.Labelf("min %g, max %g, avg %g over %d values", t.numbers.min, t.numbers.max, t.numbers.avg(), t.numbers.count),
+				g.SmallButton("Reset stats").OnClick(func() {
+					// detailView runs with mux held for reading.
+					go func() {
+						mux.Lock()
+						t.numbers = numericStats{}
+						mux.Unlock()
+						refresh()
+					}()
+				}),
+			),
+		}, nil),
+		g.Condition(t.duplicates > 0, g.Layout{
+			g.Labelf("%d duplicates ignored", t.duplicates),
+		}, nil),
+		g.Condition(t.schemaError != "", g.Layout{
+			g.Style().SetColor(g.StyleColorText, invalidColor).To(
+				g.Label("Schema violation: " + t.schemaError).Wrapped(true),
+			),
+		}, nil),
+		g.Separator(),
+		payloadView(*t.friendlyPayload),
+		g.Separator(),
+		sizeHistogram(t),
+	}
+}
+
+// payloadView shows JSON objects and arrays as a tree and other payloads as
+// text.
+func payloadView(payload string) g.Widget {
+	if v := jsonContainer(payload); v != nil {
+		return jsonTree(v)
+	}
+	return g.Label(payload).Wrapped(true)
+}
+
+// sizeHistogram plots the distribution of payload sizes received on t.
+func sizeHistogram(t *topic) g.Widget {
+	last := 0
+	for i, n := range t.sizes {
+		if n > 0 {
+			last = i
+		}
+	}
+
+	var data []float64
+	var ticks []g.PlotTicker
+	max := 0
+	for i := 0; i <= last; i++ {
+		n := t.sizes[i]
+		if n > max {
+			max = n
+		}
+		data = append(data, float64(n))
+
+		label := "0"
+		if i > 0 {
+			label = "<" + formatSize(1<<i)
+		}
+		ticks = append(ticks, g.PlotTicker{Position: float64(i), Label: label})
+	}
+
+	return g.Plot("Payload sizes").
+		AxisLimits(-0.5, float64(last)+0.5, 0, float64(max)*1.1, g.ConditionAlways).
+		XTicks(ticks, false).
+		Size(-1, 150).
+		Plots(g.Bar("messages", data))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var diagnoseFlag = flag.Bool("diagnose", false, "log the steps of connecting to the broker: address resolution, TLS handshake, protocol version and granted subscriptions")
+
+// diag logs a diagnostic message if -diagnose is given.
+func diag(format string, a ...interface{}) {
+	if *diagnoseFlag {
+		log.Printf("diagnose: "+format, a...)
+	}
+}
+
+// defaultPorts are the ports paho connects to if the broker URL has none.
+var defaultPorts = map[string]string{
+	"mqtt": "1883", "tcp": "1883",
+	"ssl": "8883", "tls": "8883", "mqtts": "8883", "mqtt+ssl": "8883", "tcps": "8883",
+	"ws": "80", "wss": "443",
+}
+
+// diagnose checks the connection to the broker of cfg step by step and logs
+// the results, stopping at the first step that fails.
+func diagnose(cfg Config) {
+	u, err := url.Parse(cfg.Broker)
+	if err != nil {
+		diag("invalid broker URL: %v", err)
+		return
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = defaultPorts[u.Scheme]
+	}
+	diag("broker %s, scheme %s, host %s, port %s", cfg.Broker, u.Scheme, host, port)
+
+	var dial func(addr string) (net.Conn, error)
+	if cfg.Proxy != "" {
+		pu, err := parseProxy(cfg.Proxy)
+		if err != nil {
+			diag("%v", err)
+			return
+		}
+		d, err := proxyDialer(pu)
+		if err != nil {
+			diag("proxy %s: %v", pu.Redacted(), err)
+			return
+		}
+		diag("connecting through proxy %s, which resolves the broker host", pu.Redacted())
+		dial = func(addr string) (net.Conn, error) { return d.Dial("tcp", addr) }
+	} else {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			diag("resolving %s failed: %v", host, err)
+			return
+		}
+		diag("%s resolves to %v", host, addrs)
+		dial = func(addr string) (net.Conn, error) { return net.DialTimeout("tcp", addr, 10*time.Second) }
+	}
+
+	addr := net.JoinHostPort(host, port)
+	start := time.Now()
+	conn, err := dial(addr)
+	if err != nil {
+		diag("connecting to %s failed: %v", addr, err)
+		return
+	}
+	diag("connected to %s (%s) in %s", addr, conn.RemoteAddr(), time.Since(start).Round(time.Millisecond))
+	defer conn.Close()
+
+	if secure, _ := isTLSScheme(cfg.Broker); !secure {
+		return
+	}
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		diag("%v", err)
+		return
+	}
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = host
+	}
+
+	cs, err := handshake(conn, tlsCfg)
+	if err != nil {
+		diag("TLS handshake with server name %s failed: %v", tlsCfg.ServerName, err)
+		// Handshake again without verification to see the certificates,
+		// that's when they are needed most.
+		if conn, err := dial(addr); err == nil {
+			defer conn.Close()
+			insecure := tlsCfg.Clone()
+			insecure.InsecureSkipVerify = true
+			if cs, err := handshake(conn, insecure); err == nil {
+				logCertificates(cs.PeerCertificates)
+			}
+		}
+		return
+	}
+	diag("TLS handshake succeeded: version %s, cipher suite %s, ALPN %q, server name %s",
+		tlsVersionName(cs.Version), tls.CipherSuiteName(cs.CipherSuite), cs.NegotiatedProtocol, tlsCfg.ServerName)
+	logCertificates(cs.PeerCertificates)
+}
+
+func handshake(conn net.Conn, cfg *tls.Config) (tls.ConnectionState, error) {
+	tc := tls.Client(conn, cfg)
+	_ = tc.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := tc.Handshake(); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return tc.ConnectionState(), nil
+}
+
+func logCertificates(chain []*x509.Certificate) {
+	for i, c := range chain {
+		diag("certificate %d: subject %q, issuer %q, valid %s to %s, DNS names %v",
+			i, c.Subject, c.Issuer, c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339), c.DNSNames)
+	}
+}
+
+// protocolName returns the name of the MQTT protocol level v.
+func protocolName(v uint) string {
+	switch v {
+	case 3:
+		return "MQTT 3.1"
+	case 4:
+		return "MQTT 3.1.1"
+	}
+	return fmt.Sprintf("protocol level %d", v)
+}
+
+// enablePahoLogs makes paho log errors and warnings, such as the reason a
+// broker refused the connection.
+func enablePahoLogs() {
+	mqtt.ERROR = log.New(os.Stderr, "paho error: ", log.LstdFlags)
+	mqtt.WARN = log.New(os.Stderr, "paho warning: ", log.LstdFlags)
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+	return "unknown"
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseLogsUntrustedCertificates(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	*diagnoseFlag = true
+	defer func() { *diagnoseFlag = false }()
+
+	cfg := testConfig()
+	cfg.Broker = strings.Replace(srv.URL, "https", "ssl", 1)
+	diagnose(cfg)
+
+	out := buf.String()
+	for _, want := range []string{"connected to 127.0.0.1:", "TLS handshake with server name 127.0.0.1 failed", "certificate 0: subject"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output misses %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/color"
+	"os"
+	"sort"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+var baselineFlag = flag.String("baseline", "", "snapshot file (as written by -snapshot) to compare the tree against")
+
+var (
+	// baseline is the snapshot the tree is compared against.
+	baseline []exportedTopic
+	showDiff bool
+)
+
+var (
+	addedColor   = color.RGBA{R: 0x4c, G: 0xc9, B: 0x4c, A: 0xff}
+	removedColor = color.RGBA{R: 0xe0, G: 0x4f, B: 0x4f, A: 0xff}
+	changedColor = color.RGBA{R: 0xe0, G: 0xc0, B: 0x3a, A: 0xff}
+)
+
+type diffKind int
+
+const (
+	diffAdded diffKind = iota
+	diffRemoved
+	diffChanged
+)
+
+type diffEntry struct {
+	kind     diffKind
+	old, new exportedTopic
+}
+
+// loadBaseline reads a snapshot file written by -snapshot.
+func loadBaseline(name string) ([]exportedTopic, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var topics []exportedTopic
+	if err := json.Unmarshal(b, &topics); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", name, err)
+	}
+	return topics, nil
+}
+
+// saveBaseline makes the current tree the baseline for the diff.
+func saveBaseline() {
+	mux.RLock()
+	baseline = exportTopics(&root)
+	mux.RUnlock()
+}
+
+// diffTopics returns all topics that were added, removed or changed between
+// old and new, keyed by topic.
+func diffTopics(old, new []exportedTopic) map[string]diffEntry {
+	entries := make(map[string]diffEntry)
+	for _, o := range old {
+		entries[o.Topic] = diffEntry{kind: diffRemoved, old: o}
+	}
+	for _, n := range new {
+		o, ok := entries[n.Topic]
+		switch {
+		case !ok:
+			entries[n.Topic] = diffEntry{kind: diffAdded, new: n}
+		case bytes.Equal(o.old.Payload, n.Payload):
+			delete(entries, n.Topic)
+		default:
+			entries[n.Topic] = diffEntry{kind: diffChanged, old: o.old, new: n}
+		}
+	}
+	return entries
+}
+
+// diffNode is a node in the tree built from the diff entries.
+type diffNode struct {
+	children map[string]*diffNode
+	entry    *diffEntry
+}
+
+func diffTableRows() []*g.TreeTableRowWidget {
+	mux.RLock()
+	current := exportTopics(&root)
+	mux.RUnlock()
+
+	tree := &diffNode{}
+	for topic, e := range diffTopics(baseline, current) {
+		e := e
+		n := tree
+		for _, name := range strings.Split(topic, "/") {
+			if n.children == nil {
+				n.children = make(map[string]*diffNode)
+			}
+			c, ok := n.children[name]
+			if !ok {
+				c = &diffNode{}
+				n.children[name] = c
+			}
+			n = c
+		}
+		n.entry = &e
+	}
+	return tree.tableRows()
+}
+
+func (n *diffNode) tableRows() []*g.TreeTableRowWidget {
+	keys := make([]string, 0, len(n.children))
+	for k := range n.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var cw []*g.TreeTableRowWidget
+	for _, k := range keys {
+		c := n.children[k]
+		if c.children == nil {
+			cw = append(cw, g.TreeTableRow(rowLabel(levelName(k), k), c.entry.label()).Flags(g.TreeNodeFlagsSpanAvailWidth|g.TreeNodeFlagsLeaf))
+		} else {
+			cw = append(cw, g.TreeTableRow(rowLabel(levelName(k), k)).Flags(g.TreeNodeFlagsSpanAvailWidth|g.TreeNodeFlagsDefaultOpen).Children(c.tableRows()...))
+		}
+	}
+	return cw
+}
+
+func (e *diffEntry) label() g.Widget {
+	var c color.Color
+	var text string
+	switch e.kind {
+	case diffAdded:
+		c, text = addedColor, "+ "+e.new.Value
+	case diffRemoved:
+		c, text = removedColor, "- "+e.old.Value
+	default:
+		c, text = changedColor, e.old.Value+" -> "+e.new.Value
+	}
+	return g.Style().SetColor(g.StyleColorText, c).To(g.Label(text))
+}
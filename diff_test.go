@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestDiffTopics(t *testing.T) {
+	old := []exportedTopic{
+		{Topic: "a/same", Payload: []byte("1")},
+		{Topic: "a/changed", Payload: []byte("1")},
+		{Topic: "a/removed", Payload: []byte("1")},
+		{Topic: "b/emptied", Payload: []byte("1")},
+	}
+	new := []exportedTopic{
+		{Topic: "a/same", Payload: []byte("1")},
+		{Topic: "a/changed", Payload: []byte("2")},
+		{Topic: "a/added", Payload: []byte("3")},
+		{Topic: "b/emptied", Payload: []byte{}},
+	}
+
+	tests := []struct {
+		topic    string
+		kind     diffKind
+		old, new string
+	}{
+		{"a/changed", diffChanged, "1", "2"},
+		{"a/removed", diffRemoved, "1", ""},
+		{"a/added", diffAdded, "", "3"},
+		{"b/emptied", diffChanged, "1", ""},
+	}
+	entries := diffTopics(old, new)
+	if len(entries) != len(tests) {
+		t.Errorf("diffTopics() = %d entries, want %d", len(entries), len(tests))
+	}
+	if _, ok := entries["a/same"]; ok {
+		t.Error("unchanged topic in the diff")
+	}
+	for _, tt := range tests {
+		e, ok := entries[tt.topic]
+		if !ok {
+			t.Errorf("%s missing from the diff", tt.topic)
+			continue
+		}
+		if e.kind != tt.kind || string(e.old.Payload) != tt.old || string(e.new.Payload) != tt.new {
+			t.Errorf("%s = kind %d, %q to %q, want kind %d, %q to %q", tt.topic, e.kind, e.old.Payload, e.new.Payload, tt.kind, tt.old, tt.new)
+		}
+	}
+
+	if got := diffTopics(nil, nil); len(got) != 0 {
+		t.Errorf("diffTopics(nil, nil) = %v, want none", got)
+	}
+}
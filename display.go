@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The tree shows topics as they are, except for these display-only changes.
+// Copying, publishing and subscribing always use the received topic, and
+// the levels of the tree join back to it exactly.
+//
+//   - Level names that would be invisible or break the row are quoted: empty
+//     ones, as in a//b or /a, those of only spaces, and those containing
+//     control characters such as newlines.
+//   - ## is shown as # #, since imgui takes it for the start of a hidden
+//     widget ID.
+
+// levelName returns the name of a tree level as displayed.
+func levelName(name string) string {
+	if strings.TrimSpace(name) == "" || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// imguiText returns s with ## broken up, so that imgui shows all of it. A
+// trailing # is followed by a space so that it can't run into the ## of an ID
+// appended to s.
+func imguiText(s string) string {
+	for strings.Contains(s, "##") {
+		s = strings.ReplaceAll(s, "##", "# #")
+	}
+	if strings.HasSuffix(s, "#") {
+		s += " "
+	}
+	return s
+}
+
+// rowLabel returns the label of a tree row showing text, identified among
+// its siblings by id whatever the text is.
+func rowLabel(text, id string) string {
+	return imguiText(text) + "###" + id
+}
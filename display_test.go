@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestLevelName(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{
+		{"kitchen", "kitchen"},
+		{"living room", "living room"},
+		{"Küche 🌡", "Küche 🌡"},
+		{"", `""`},
+		{"  ", `"  "`},
+		{"line\nbreak", `"line\nbreak"`},
+	} {
+		if got := levelName(tt.name); got != tt.want {
+			t.Errorf("levelName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImguiText(t *testing.T) {
+	for _, tt := range []struct{ s, want string }{
+		{"a#b", "a#b"},
+		{"a##b", "a# #b"},
+		{"a###b", "a# # #b"},
+		{"a#", "a# "},
+	} {
+		if got := imguiText(tt.s); got != tt.want {
+			t.Errorf("imguiText(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestUnusualTopicsRoundTrip(t *testing.T) {
+	resetTree(t)
+	topics := []string{
+		"living room/lamp 1",
+		"Küche/Temperatür/🌡",
+		"/leading",
+		"trailing/",
+		"a//b",
+		"weird/##id###x",
+		"weird/line\nbreak",
+	}
+	for _, topic := range topics {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	for _, topic := range topics {
+		n := root.find(topic)
+		if n == nil {
+			t.Errorf("%q not in the tree", topic)
+			continue
+		}
+		if got := n.topicPath(); got != topic {
+			t.Errorf("path of %q = %q", topic, got)
+		}
+		if got, want := n.topicValue(), topic+"=1"; got != want {
+			t.Errorf("topicValue() = %q, want %q", got, want)
+		}
+		if got := n.subscriptionFilter(); got != topic {
+			t.Errorf("subscriptionFilter() of %q = %q", topic, got)
+		}
+	}
+	if got, want := root.find("a//b").parent.label(), `""`; got != want {
+		t.Errorf("label of the empty level = %q, want %q", got, want)
+	}
+}
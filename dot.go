@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+var (
+	dotFlag       = flag.Bool("dot", false, "print the topic hierarchy received within -snapshot-settle as a Graphviz DOT graph and exit")
+	dotValuesFlag = flag.Bool("dot-values", false, "include the values of topics in the graph printed with -dot or copied from the tree")
+)
+
+// writeDOT writes the hierarchy of the topics below t to w as a Graphviz
+// graph, t itself being the top node unless it is the root. With values,
+// topics are labeled with their value, too. The caller must hold mux.
+func writeDOT(w io.Writer, t *topic, values bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph topics {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	if t.parent != nil {
+		writeDOTNode(bw, t, values)
+	}
+	writeDOTChildren(bw, t, values)
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func writeDOTChildren(w io.Writer, t *topic, values bool) {
+	keys := make([]string, 0, len(t.children))
+	for k := range t.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		c := t.children[k]
+		writeDOTNode(w, c, values)
+		if t.parent != nil {
+			fmt.Fprintf(w, "\t%s -> %s;\n", dotQuote(t.path()), dotQuote(c.path()))
+		}
+		writeDOTChildren(w, c, values)
+	}
+}
+
+func writeDOTNode(w io.Writer, t *topic, values bool) {
+	label := t.name
+	if values && t.last != nil {
+		label += "\n" + preview(t.value(), *previewLenFlag)
+	}
+	fmt.Fprintf(w, "\t%s [label=%s];\n", dotQuote(t.path()), dotQuote(label))
+}
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// copyDOT copies the graph of the topics below t to the clipboard.
+func copyDOT(t *topic) {
+	var b strings.Builder
+	mux.RLock()
+	_ = writeDOT(&b, t, *dotValuesFlag)
+	mux.RUnlock()
+	g.Context.GetPlatform().SetClipboard(b.String())
+}
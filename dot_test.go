@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	resetTree(t)
+	for _, m := range []exportedTopic{
+		{Topic: "home/kitchen/temp", Payload: []byte("21.5")},
+		{Topic: "home/door", Payload: []byte("open")},
+	} {
+		defaultHandler(nil, &forwardedMessage{m})
+	}
+
+	var b strings.Builder
+	mux.RLock()
+	err := writeDOT(&b, &root, true)
+	mux.RUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph topics {
+	rankdir=LR;
+	node [shape=box];
+	"home" [label="home"];
+	"home/door" [label="door\n\"open\""];
+	"home" -> "home/door";
+	"home/kitchen" [label="kitchen"];
+	"home" -> "home/kitchen";
+	"home/kitchen/temp" [label="temp\n21.5"];
+	"home/kitchen" -> "home/kitchen/temp";
+}
+`
+	if b.String() != want {
+		t.Errorf("writeDOT() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+// encoding is the way a payload was decoded for display.
+type encoding int
+
+const (
+	encodingNone encoding = iota
+	encodingJSON
+	encodingText
+	encodingNumber
+	encodingBool
+	encodingBinary
+	encodingSparkplug
+	encodingCSV
+	encodingRaw
+	numEncodings
+)
+
+var encodingNames = [numEncodings]string{
+	encodingJSON:      "JSON",
+	encodingText:      "text",
+	encodingNumber:    "numeric",
+	encodingBool:      "boolean",
+	encodingBinary:    "binary",
+	encodingSparkplug: "Sparkplug",
+	encodingCSV:       "CSV",
+	encodingRaw:       "raw",
+}
+
+// badgeColor is the color of the type badges.
+var badgeColor = color.RGBA{R: 0x9a, G: 0x9a, B: 0xb0, A: 0xff}
+
+// showTypeBadges shows how the value of each topic was decoded in front of
+// it.
+var showTypeBadges bool
+
+// typeBadge returns w preceded by how the value of t was decoded, if
+// showTypeBadges is set.
+func (t *topic) typeBadge(w g.Widget) g.Widget {
+	if !showTypeBadges || t.encoding == encodingNone {
+		return w
+	}
+	return g.Row(g.Style().SetColor(g.StyleColorText, badgeColor).To(g.Label(encodingNames[t.encoding])), w)
+}
+
+// encodingCounts holds the number of topics whose last payload was decoded
+// with each encoding. It is protected by mux.
+var encodingCounts [numEncodings]int
+
+// setEncoding records that the last payload of t was decoded with enc.
+func (t *topic) setEncoding(enc encoding) {
+	if t.encoding != encodingNone {
+		encodingCounts[t.encoding]--
+	}
+	encodingCounts[enc]++
+	t.encoding = enc
+}
+
+// encodingSummary returns the number of topics per encoding for the status
+// line, e.g. "12 JSON, 3 text".
+func encodingSummary() string {
+	mux.RLock()
+	defer mux.RUnlock()
+	var parts []string
+	for enc := encodingJSON; enc < numEncodings; enc++ {
+		if n := encodingCounts[enc]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, encodingNames[enc]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// envFlags maps flag names to environment variables that provide their
+// defaults. A flag given on the command line always takes precedence over
+// the environment, which in turn takes precedence over the built-in default.
+var envFlags = map[string]string{
+	"broker":          "ZAPPER_BROKER",
+	"username":        "ZAPPER_USERNAME",
+	"password":        "ZAPPER_PASSWORD",
+	"client-id":       "ZAPPER_CLIENT_ID",
+	"pkcs12-password": "ZAPPER_PKCS12_PASSWORD",
+	"key-password":    "ZAPPER_KEY_PASSWORD",
+}
+
+// applyEnv sets all flags that were not given on the command line from
+// their environment variables. It must be called after flag.Parse.
+func applyEnv() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for name, env := range envFlags {
+		if set[name] {
+			continue
+		}
+		if v, ok := os.LookupEnv(env); ok {
+			if err := flag.Set(name, v); err != nil {
+				return fmt.Errorf("invalid %s: %w", env, err)
+			}
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+
+	names := make([]string, 0, len(envFlags))
+	for name := range envFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(out, "\nEnvironment variables (overridden by flags):\n")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\tdefault for -%s\n", envFlags[name], name)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// exportedTopic is the JSON representation of a single topic.
+type exportedTopic struct {
+	Topic    string `json:"topic"`
+	Value    string `json:"value"`
+	Payload  []byte `json:"payload"`
+	QoS      byte   `json:"qos,omitempty"`
+	Retained bool   `json:"retained"`
+}
+
+// exportTopics returns all topics below t that received a message, sorted by topic.
+// The caller must hold mux.
+func exportTopics(t *topic) []exportedTopic {
+	var topics []exportedTopic
+	t.walk(func(c *topic) {
+		if c.last == nil {
+			return
+		}
+		topics = append(topics, exportedTopic{
+			Topic:    c.last.Topic(),
+			Value:    *c.friendlyPayload,
+			Payload:  c.last.Payload(),
+			QoS:      c.last.Qos(),
+			Retained: c.last.Retained(),
+		})
+	})
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Topic < topics[j].Topic
+	})
+	return topics
+}
+
+// writeJSON writes all topics below t to w as an indented JSON array.
+// The caller must hold mux.
+func writeJSON(w io.Writer, t *topic) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(exportTopics(t))
+}
+
+// sortedLeaves returns the topics below t that received a message, sorted by
+// topic. The caller must hold mux.
+func sortedLeaves(t *topic) []*topic {
+	var leaves []*topic
+	t.walk(func(c *topic) {
+		if c.last != nil {
+			leaves = append(leaves, c)
+		}
+	})
+	sort.Slice(leaves, func(i, j int) bool {
+		return leaves[i].last.Topic() < leaves[j].last.Topic()
+	})
+	return leaves
+}
+
+// writeValues writes a line with the topic and the value as shown in the
+// tree for all topics below t to w, sorted by topic. It returns the number
+// of topics written. The caller must hold mux.
+func writeValues(w io.Writer, t *topic) (int, error) {
+	leaves := sortedLeaves(t)
+	bw := bufio.NewWriter(w)
+	for _, c := range leaves {
+		fmt.Fprintf(bw, "%s %s\n", c.last.Topic(), c.value())
+	}
+	return len(leaves), bw.Flush()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteValues(t *testing.T) {
+	resetTree(t)
+	for _, m := range []exportedTopic{
+		{Topic: "b/temp", Payload: []byte("21.5")},
+		{Topic: "a", Payload: []byte(`{"on":true}`)},
+		{Topic: "b/name", Payload: []byte("boiler")},
+	} {
+		defaultHandler(nil, &forwardedMessage{m})
+	}
+
+	var buf bytes.Buffer
+	mux.RLock()
+	n, err := writeValues(&buf, &root)
+	mux.RUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a {\"on\":true}\nb/name \"boiler\"\nb/temp 21.5\n"
+	if n != 3 || buf.String() != want {
+		t.Errorf("writeValues() = %d, %q, want 3, %q", n, buf.String(), want)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	resetTree(t)
+	defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: "a/temp", Payload: []byte("21.5"), Retained: true}})
+	defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: "a/note", Payload: []byte("{\n\"on\": true\n}")}})
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mux.Lock()
+	for _, topic := range []string{"a/temp", "a/note"} {
+		lookupLocked(topic).lastSeen = now.Add(-time.Minute)
+	}
+	mux.Unlock()
+
+	var buf bytes.Buffer
+	s := session{Broker: "tcp://broker:1883", ClientID: "zapper-1", ConnectedAt: now.Add(-time.Hour)}
+	mux.RLock()
+	err := writeReport(&buf, s, &root, now)
+	mux.RUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `zapper session report
+
+Broker:    tcp://broker:1883
+Client ID: zapper-1
+Connected: 2024-05-01T11:00:00Z (1h0m0s ago)
+Generated: 2024-05-01T12:00:00Z
+Topics:    2
+
+TOPIC   VALUE             LAST SEEN             RETAINED
+a/note  {\n"on": true\n}  2024-05-01T11:59:00Z  false
+a/temp  21.5              2024-05-01T11:59:00Z  true
+`
+	if buf.String() != want {
+		t.Errorf("writeReport() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
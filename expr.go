@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// maxExprNodes is the most nodes the syntax tree of a transform expression
+// may have. Expressions are evaluated under mux for every message, so they
+// must be quick. Expr has no loops and its VM limits the memory of ranges
+// and collections, so bounding the size of the expression and rejecting
+// repeat bounds the time it takes.
+const maxExprNodes = 256
+
+// exprLimits records the size of an expression and whether it calls repeat
+// while it is compiled.
+type exprLimits struct {
+	nodes  int
+	repeat bool
+}
+
+func (l *exprLimits) Visit(node *ast.Node) {
+	l.nodes++
+	if b, ok := (*node).(*ast.BuiltinNode); ok && b.Name == "repeat" {
+		l.repeat = true
+	}
+}
+
+// compileExpr compiles the transform expression src, rejecting expressions
+// that could take long to evaluate.
+func compileExpr(src string) (*vm.Program, error) {
+	l := &exprLimits{}
+	p, err := expr.Compile(src, expr.Patch(l))
+	if err != nil {
+		return nil, err
+	}
+	if l.repeat {
+		return nil, errors.New("repeat is not allowed")
+	}
+	if l.nodes > maxExprNodes {
+		return nil, fmt.Errorf("expression too large, %d nodes, at most %d allowed", l.nodes, maxExprNodes)
+	}
+	return p, nil
+}
+
+// evalExpr evaluates the expression p for payload and formats the result
+// for display. The expression sees the decoded payload as value, JSON being
+// decoded into numbers, strings, booleans, arrays and maps, and the
+// undecoded payload as a string as payload.
+func evalExpr(p *vm.Program, payload []byte) (string, error) {
+	var value interface{} = string(payload)
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err == nil {
+		value = v
+	}
+	out, err := expr.Run(p, map[string]interface{}{
+		"value":   value,
+		"payload": string(payload),
+	})
+	if err != nil {
+		return "", err
+	}
+	return formatExprResult(out)
+}
+
+func formatExprResult(out interface{}) (string, error) {
+	switch out := out.(type) {
+	case string:
+		return out, nil
+	case float64:
+		return strconv.FormatFloat(out, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(out), nil
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
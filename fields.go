@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	g "github.com/AllenDang/giu"
+)
+
+// expandFields shows the fields of JSON object payloads as rows below their
+// topic, in addition to topics expanded individually.
+var expandFields bool
+
+// jsonField is a field of a JSON object payload. Fields of nested objects
+// are expanded as well.
+type jsonField struct {
+	name   string
+	value  string
+	fields []jsonField
+}
+
+// jsonFields returns the fields of the JSON object s sorted by name, or nil
+// if s is not an object.
+func jsonFields(s string) []jsonField {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &obj); err != nil || obj == nil {
+		return nil
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]jsonField, 0, len(names))
+	for _, name := range names {
+		var b bytes.Buffer
+		if err := json.Compact(&b, obj[name]); err != nil {
+			return nil
+		}
+		fields = append(fields, jsonField{
+			name:   name,
+			value:  b.String(),
+			fields: jsonFields(b.String()),
+		})
+	}
+	return fields
+}
+
+// fieldRows returns the pseudo rows of t's JSON fields if they are expanded.
+// They only display the payload, the topic and its value stay the same.
+func (t *topic) fieldRows() []*g.TreeTableRowWidget {
+	if !expandFields && !t.fieldsExpanded {
+		return nil
+	}
+	return fieldRows(jsonFields(t.value()))
+}
+
+func fieldRows(fields []jsonField) []*g.TreeTableRowWidget {
+	rows := make([]*g.TreeTableRowWidget, 0, len(fields))
+	for _, f := range fields {
+		if f.fields != nil {
+			rows = append(rows, g.TreeTableRow(f.name, g.Label(preview(f.value, *previewLenFlag))).
+				Flags(g.TreeNodeFlagsSpanAvailWidth).
+				Children(fieldRows(f.fields)...))
+		} else {
+			rows = append(rows, g.TreeTableRow(f.name, g.Label(preview(f.value, *previewLenFlag))).
+				Flags(g.TreeNodeFlagsSpanAvailWidth|g.TreeNodeFlagsLeaf))
+		}
+	}
+	return rows
+}
+
+// toggleFields expands or collapses the JSON fields of t.
+func toggleFields(t *topic) {
+	go func() {
+		mux.Lock()
+		t.fieldsExpanded = !t.fieldsExpanded
+		mux.Unlock()
+		refresh()
+	}()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONFields(t *testing.T) {
+	got := jsonFields(`{"b": [1, 2], "a": {"y": true, "x": null}, "c": "s"}`)
+	want := []jsonField{
+		{name: "a", value: `{"y":true,"x":null}`, fields: []jsonField{
+			{name: "x", value: "null"},
+			{name: "y", value: "true"},
+		}},
+		{name: "b", value: "[1,2]"},
+		{name: "c", value: `"s"`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonFields() = %+v, want %+v", got, want)
+	}
+
+	for _, s := range []string{"", "1", `"{}"`, "[{}]", "null", "{"} {
+		if got := jsonFields(s); got != nil {
+			t.Errorf("jsonFields(%q) = %+v, want nil", s, got)
+		}
+	}
+}
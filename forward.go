@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// A forwarding agent is a headless zapper that sends the messages it receives
+// to a viewer started with -listen. The agent dials the viewer, so only the
+// viewer has to be reachable. On the wire, every message is one exportedTopic
+// encoded as a line of JSON. The agent starts each connection with the
+// topics it already knows.
+var (
+	forwardFlag = flag.String("forward", "", "run headless and forward messages to the viewer at host:port (unencrypted)")
+	listenFlag  = flag.String("listen", "", "show messages of forwarding agents connecting to this address instead of connecting to a broker")
+)
+
+// forwardQueue is the size of the queue of messages waiting to be sent to
+// the viewer. Messages are dropped while it is full.
+const forwardQueue = 1024
+
+// forwardCh receives the messages to forward while a viewer is connected. It
+// is protected by mux.
+var forwardCh chan exportedTopic
+
+// forwardMessage queues msg for the viewer, if one is connected. The caller
+// must hold mux.
+func forwardMessage(msg mqtt.Message) {
+	if forwardCh == nil {
+		return
+	}
+	t := exportedTopic{
+		Topic:    msg.Topic(),
+		Value:    sanitize(msg.Payload()),
+		Payload:  msg.Payload(),
+		QoS:      msg.Qos(),
+		Retained: msg.Retained(),
+	}
+	select {
+	case forwardCh <- t:
+	default:
+		log.Println("forward queue full, dropping message on", t.Topic)
+	}
+}
+
+// forward connects to the viewer at addr and streams messages to it. It
+// reconnects with backoff and never returns.
+func forward(addr string) {
+	var delay time.Duration
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			delay = backoff(delay, *reconnectMinFlag, *reconnectMaxFlag)
+			log.Printf("connecting to viewer %s: %v, retrying in %s", addr, err, delay.Round(time.Second))
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		log.Println("forwarding to", addr)
+		err = forwardTo(conn)
+		conn.Close()
+		log.Printf("forwarding to %s stopped: %v", addr, err)
+	}
+}
+
+// forwardTo writes the known topics and then all new messages to conn until
+// writing fails.
+func forwardTo(conn net.Conn) error {
+	ch := make(chan exportedTopic, forwardQueue)
+	mux.Lock()
+	forwardCh = ch
+	known := exportTopics(&root)
+	mux.Unlock()
+	defer func() {
+		mux.Lock()
+		forwardCh = nil
+		mux.Unlock()
+	}()
+
+	w := bufio.NewWriter(conn)
+	enc := json.NewEncoder(w)
+	for _, t := range known {
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// The viewer never sends anything, reading only detects when it is gone.
+	closed := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, conn)
+		if err == nil {
+			err = io.EOF
+		}
+		closed <- err
+	}()
+
+	for {
+		select {
+		case t := <-ch:
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+			// Send queued messages in one go.
+			if len(ch) == 0 {
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+		case err := <-closed:
+			return err
+		}
+	}
+}
+
+// listen accepts forwarding agents on addr and adds their messages to the
+// tree.
+func listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	setStatus("listening for agents on %s", ln.Addr())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Println("accepting agent:", err)
+				return
+			}
+			go receive(conn)
+		}
+	}()
+	return nil
+}
+
+// receive reads forwarded messages from conn until it is closed.
+func receive(conn net.Conn) {
+	defer conn.Close()
+	setStatus("receiving from agent %s", conn.RemoteAddr())
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var t exportedTopic
+		if err := dec.Decode(&t); err != nil {
+			setStatus("agent %s disconnected: %v", conn.RemoteAddr(), err)
+			return
+		}
+		defaultHandler(nil, &forwardedMessage{t})
+	}
+}
+
+// forwardedMessage is a message received from a forwarding agent.
+type forwardedMessage struct {
+	t exportedTopic
+}
+
+func (m *forwardedMessage) Duplicate() bool   { return false }
+func (m *forwardedMessage) Qos() byte         { return m.t.QoS }
+func (m *forwardedMessage) Retained() bool    { return m.t.Retained }
+func (m *forwardedMessage) Topic() string     { return m.t.Topic }
+func (m *forwardedMessage) MessageID() uint16 { return 0 }
+func (m *forwardedMessage) Payload() []byte   { return m.t.Payload }
+func (m *forwardedMessage) Ack()              {}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestForwardSendsKnownAndNewMessages(t *testing.T) {
+	resetTree(t)
+	broker.publish("known", []byte("1"), true)
+	connectTest(t)
+	waitFor(t, "known")
+
+	agent, viewer := net.Pipe()
+	done := make(chan error)
+	go func() { done <- forwardTo(agent) }()
+	dec := json.NewDecoder(viewer)
+
+	var rec exportedTopic
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Topic != "known" || string(rec.Payload) != "1" || !rec.Retained {
+		t.Errorf("first record = %+v, want retained known=1", rec)
+	}
+
+	broker.publish("new", []byte("2"), false)
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Topic != "new" || rec.Value != "2" || rec.Retained {
+		t.Errorf("second record = %+v, want new=2", rec)
+	}
+
+	viewer.Close()
+	if err := <-done; err == nil {
+		t.Error("forwardTo returned without error after the viewer left")
+	}
+	mux.RLock()
+	defer mux.RUnlock()
+	if forwardCh != nil {
+		t.Error("forward channel not reset")
+	}
+}
+
+func TestReceiveAddsForwardedMessages(t *testing.T) {
+	resetTree(t)
+
+	viewer, agent := net.Pipe()
+	go receive(viewer)
+	defer agent.Close()
+
+	rec := exportedTopic{Topic: "remote/sensor", Value: "7", Payload: []byte("7"), QoS: 1}
+	if err := json.NewEncoder(agent).Encode(rec); err != nil {
+		t.Fatal(err)
+	}
+	if v := waitFor(t, "remote/sensor"); v != "7" {
+		t.Errorf("remote/sensor = %s, want 7", v)
+	}
+	if q := lookup("remote/sensor").last.Qos(); q != 1 {
+		t.Errorf("QoS = %d, want 1", q)
+	}
+}
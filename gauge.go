@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	g "github.com/AllenDang/giu"
+)
+
+var gaugeFlag = flag.Bool("gauge", false, "show a gauge for numeric values between 0 and 100, such as percentages")
+
+// gaugeRule shows a gauge for numeric values of topics matching Filter,
+// filled from Min to Max. Min and Max default to 0 and 100.
+type gaugeRule struct {
+	Filter string   `json:"filter"`
+	Min    *float64 `json:"min"`
+	Max    *float64 `json:"max"`
+}
+
+// showGauges reports whether the tree has a gauge column.
+func showGauges() bool {
+	return *gaugeFlag || len(config.Gauges) > 0
+}
+
+// gaugeFraction returns how far value fills the gauge of topic, between 0
+// and 1. Values outside a configured range fill the gauge fully or not at
+// all. Without a rule for topic, only values from 0 to 100 have a gauge if
+// -gauge is given.
+func gaugeFraction(topic, value string) (float32, bool) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	for _, r := range config.Gauges {
+		if !matchFilter(r.Filter, topic) {
+			continue
+		}
+		min, max := 0.0, 100.0
+		if r.Min != nil {
+			min = *r.Min
+		}
+		if r.Max != nil {
+			max = *r.Max
+		}
+		if max <= min {
+			return 0, false
+		}
+		f := (v - min) / (max - min)
+		if f < 0 {
+			f = 0
+		} else if f > 1 {
+			f = 1
+		}
+		return float32(f), true
+	}
+	if !*gaugeFlag || v < 0 || v > 100 {
+		return 0, false
+	}
+	return float32(v / 100), true
+}
+
+// gauge returns the cell of t in the gauge column, empty if its value has
+// no gauge.
+func (t *topic) gauge() g.Widget {
+	f, ok := gaugeFraction(t.last.Topic(), t.value())
+	if !ok {
+		return g.Layout{}
+	}
+	return g.ProgressBar(f).Size(g.Auto, 0).Overlay("")
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestGaugeFraction(t *testing.T) {
+	defer func() { config = fileConfig{} }()
+	defer func(v bool) { *gaugeFlag = v }(*gaugeFlag)
+	min, max := -20.0, 40.0
+	config.Gauges = []gaugeRule{
+		{Filter: "room/+/temperature", Min: &min, Max: &max},
+		{Filter: "tank/level"},
+	}
+	*gaugeFlag = true
+
+	tests := []struct {
+		topic, value string
+		want         float32
+		ok           bool
+	}{
+		{"room/kitchen/temperature", "10", 0.5, true},
+		{"room/kitchen/temperature", "55", 1, true},
+		{"room/kitchen/temperature", "-30", 0, true},
+		{"tank/level", "25", 0.25, true},
+		{"battery", "80", 0.8, true},
+		{"battery", "180", 0, false},
+		{"battery", "full", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := gaugeFraction(tt.topic, tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("gaugeFraction(%q, %q) = %v, %t, want %v, %t", tt.topic, tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// hexdump formats b like the default output of xxd: an offset, 16 bytes per
+// line in groups of two and the printable ASCII characters.
+func hexdump(b []byte) string {
+	var sb strings.Builder
+	for off := 0; off < len(b); off += 16 {
+		end := off + 16
+		if end > len(b) {
+			end = len(b)
+		}
+		line := b[off:end]
+
+		var hex strings.Builder
+		for i, c := range line {
+			if i > 0 && i%2 == 0 {
+				hex.WriteByte(' ')
+			}
+			fmt.Fprintf(&hex, "%02x", c)
+		}
+
+		ascii := make([]byte, len(line))
+		for i, c := range line {
+			if c >= 0x20 && c < 0x7f {
+				ascii[i] = c
+			} else {
+				ascii[i] = '.'
+			}
+		}
+
+		fmt.Fprintf(&sb, "%08x: %-39s  %s\n", off, hex.String(), ascii)
+	}
+	return sb.String()
+}
+
+// entropy returns the Shannon entropy of b in bits per byte, from 0 for a
+// single repeated byte to 8 for uniformly random data.
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	var e float64
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(b))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// entropyHint describes what the entropy of b suggests about its content.
+func entropyHint(b []byte) string {
+	// Short payloads can't reach a high entropy, e.g. 16 distinct bytes
+	// have only 4 bits per byte.
+	if len(b) < 64 {
+		return fmt.Sprintf("entropy %.1f bits/byte, too short to tell", entropy(b))
+	}
+	e := entropy(b)
+	switch {
+	case e > 7.5:
+		return fmt.Sprintf("entropy %.1f bits/byte, likely compressed or encrypted", e)
+	case e < 5:
+		return fmt.Sprintf("entropy %.1f bits/byte, likely text or structured data", e)
+	default:
+		return fmt.Sprintf("entropy %.1f bits/byte, likely binary data", e)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestHexdump(t *testing.T) {
+	payload := []byte("Hello, zapper!\x00\x01\xff\x7fmore\t")
+	want := "00000000: 4865 6c6c 6f2c 207a 6170 7065 7221 0001  Hello, zapper!..\n" +
+		"00000010: ff7f 6d6f 7265 09                        ..more.\n"
+	if got := hexdump(payload); got != want {
+		t.Errorf("hexdump() =\n%s\nwant\n%s", got, want)
+	}
+	if got := hexdump(nil); got != "" {
+		t.Errorf("hexdump(nil) = %q, want empty", got)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	tests := []struct {
+		b    []byte
+		want float64
+	}{
+		{nil, 0},
+		{bytes.Repeat([]byte{'a'}, 100), 0},
+		{[]byte("abab"), 1},
+		{all, 8},
+	}
+	for _, tt := range tests {
+		if got := entropy(tt.b); got != tt.want {
+			t.Errorf("entropy(%q) = %g, want %g", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEntropyHint(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := []byte(strings.Repeat(`{"temperature":21.5,"humidity":40}`, 10))
+
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"short", []byte("on"), "too short"},
+		{"random", random, "compressed or encrypted"},
+		{"text", text, "text or structured"},
+	}
+	for _, tt := range tests {
+		if got := entropyHint(tt.b); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: entropyHint = %q, want it to contain %q", tt.name, got, tt.want)
+		}
+	}
+}
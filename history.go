@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	historyDirFlag     = flag.String("history-dir", "", "append numeric values to one CSV file per topic in this directory")
+	historyMaxSizeFlag = flag.Int64("history-max-size", 10<<20, "rotate history files larger than this many bytes, keeping one old file")
+)
+
+// historyRecord is a numeric value to append to the history of a topic.
+type historyRecord struct {
+	topic string
+	at    time.Time
+	value float64
+}
+
+// historyCh queues the records to write. It is nil if -history-dir is not
+// given.
+var historyCh chan historyRecord
+
+// startHistory starts writing history files if -history-dir is given.
+func startHistory() error {
+	if *historyDirFlag == "" {
+		return nil
+	}
+	if err := os.MkdirAll(*historyDirFlag, 0o755); err != nil {
+		return err
+	}
+	historyCh = make(chan historyRecord, 1024)
+	go func() {
+		for r := range historyCh {
+			if err := appendHistory(*historyDirFlag, r, *historyMaxSizeFlag); err != nil {
+				log.Println("writing history:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// recordHistory queues value for the history of topic. Values are dropped
+// while the queue is full.
+func recordHistory(topic string, value float64) {
+	if historyCh == nil {
+		return
+	}
+	select {
+	case historyCh <- historyRecord{topic, time.Now(), value}:
+	default:
+		log.Println("history queue full, dropping value of", topic)
+	}
+}
+
+// historyFile returns the name of the history file of topic in dir. The
+// topic is escaped so that it can be recovered from the name.
+func historyFile(dir, topic string) string {
+	return filepath.Join(dir, url.PathEscape(topic)+".csv")
+}
+
+// appendHistory appends r to its history file in dir. A file that grew
+// beyond maxSize is renamed with the suffix .1, replacing an older one.
+func appendHistory(dir string, r historyRecord, maxSize int64) error {
+	name := historyFile(dir, r.topic)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	var line string
+	if fi.Size() == 0 {
+		line = "time,value\n"
+	}
+	line += fmt.Sprintf("%s,%s\n", r.at.Format(time.RFC3339Nano), strconv.FormatFloat(r.value, 'g', -1, 64))
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if maxSize > 0 && fi.Size()+int64(len(line)) > maxSize {
+		return os.Rename(name, name+".1")
+	}
+	return nil
+}
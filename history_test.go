@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendHistory(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, v := range []float64{21.5, -3} {
+		if err := appendHistory(dir, historyRecord{"home/temp", at, v}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name := historyFile(dir, "home/temp")
+	if !strings.HasSuffix(name, "home%2Ftemp.csv") {
+		t.Errorf("history file %s not escaped", name)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "time,value\n2023-05-01T12:00:00Z,21.5\n2023-05-01T12:00:00Z,-3\n"
+	if string(b) != want {
+		t.Errorf("history = %q, want %q", b, want)
+	}
+}
+
+func TestAppendHistoryRotates(t *testing.T) {
+	dir := t.TempDir()
+	r := historyRecord{"counter", time.Now(), 1}
+	for i := 0; i < 4; i++ {
+		if err := appendHistory(dir, r, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name := historyFile(dir, "counter")
+	if _, err := os.Stat(name + ".1"); err != nil {
+		t.Errorf("no rotated file: %v", err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "time,value\n") {
+		t.Errorf("new file %q has no header", b)
+	}
+}
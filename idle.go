@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	idleTimeoutFlag = flag.Duration("idle-timeout", 0, "disconnect after this long without new messages, 0 stays connected;\n"+
+		"with -snapshot, -dot or -get stop waiting for messages early once they stop arriving")
+	idleExitFlag = flag.Bool("idle-exit", false, "close the window when -idle-timeout disconnects")
+)
+
+var (
+	// lastMessageAt is the time in Unix nanoseconds of the last message
+	// received, or of connecting if none arrived yet. It must be accessed
+	// atomically.
+	lastMessageAt int64
+
+	// idleDisconnected is 1 once -idle-timeout disconnected, until another
+	// broker is connected. It must be accessed atomically.
+	idleDisconnected int32
+)
+
+// touchIdle restarts the idle timeout at now.
+func touchIdle(now time.Time) {
+	atomic.StoreInt64(&lastMessageAt, now.UnixNano())
+}
+
+// idleFor returns how long no message arrived before now.
+func idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&lastMessageAt)))
+}
+
+// idle reports whether -idle-timeout is set and has passed at now.
+func idle(now time.Time) bool {
+	return *idleTimeoutFlag > 0 && idleFor(now) >= *idleTimeoutFlag
+}
+
+// settle waits up to -snapshot-settle for messages to arrive, returning
+// early if -idle-timeout passes without any.
+func settle() {
+	deadline := time.Now().Add(*settleFlag)
+	for now := time.Now(); now.Before(deadline) && !idle(now); now = time.Now() {
+		wait := deadline.Sub(now)
+		if *idleTimeoutFlag > 0 && wait > 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}
+
+// checkIdle disconnects from the broker once -idle-timeout passed, and
+// closes the window with -idle-exit. It is called once per second.
+func checkIdle(now time.Time) {
+	if atomic.LoadInt32(&idleDisconnected) == 1 || !idle(now) {
+		return
+	}
+	c, _ := currentClient()
+	if c == nil {
+		return
+	}
+	atomic.StoreInt32(&idleDisconnected, 1)
+	c.Disconnect(250)
+	setStatus("disconnected after %s without messages", *idleTimeoutFlag)
+	if *idleExitFlag {
+		wnd.SetShouldClose(true)
+	}
+}
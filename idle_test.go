@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdle(t *testing.T) {
+	defer func(d time.Duration) { *idleTimeoutFlag = d }(*idleTimeoutFlag)
+	start := time.Now()
+	touchIdle(start)
+
+	*idleTimeoutFlag = 0
+	if idle(start.Add(time.Hour)) {
+		t.Error("idle without -idle-timeout")
+	}
+	*idleTimeoutFlag = time.Minute
+	if idle(start.Add(30 * time.Second)) {
+		t.Error("idle before -idle-timeout passed")
+	}
+	if !idle(start.Add(time.Minute)) {
+		t.Error("not idle after -idle-timeout passed")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var (
+	isolateMux sync.Mutex
+	// isolatedFilter replaces the configured subscriptions while a subtree
+	// is isolated.
+	isolatedFilter string
+)
+
+// activeSubscriptions returns the topic filters to subscribe to: the
+// isolated subtree if there is one, the ones to discover namespaces with
+// -lazy, or the ones configured in cfg.
+func activeSubscriptions(cfg Config) map[string]byte {
+	isolateMux.Lock()
+	filter := isolatedFilter
+	isolateMux.Unlock()
+	if filter != "" {
+		return map[string]byte{filter: byte(*qosFlag)}
+	}
+	if *lazyFlag > 0 {
+		return lazySubscriptions()
+	}
+	return cfg.Subscriptions
+}
+
+// isolated returns the filter of the isolated subtree, if any.
+func isolated() string {
+	isolateMux.Lock()
+	defer isolateMux.Unlock()
+	return isolatedFilter
+}
+
+// isolate subscribes to the subtree t only. If prune is set, all other topics
+// are removed from the tree. It blocks until the broker confirmed the new
+// subscription.
+func isolate(t *topic, prune bool) {
+	mux.Lock()
+	filter := t.subscriptionFilter()
+	if prune {
+		pruneTo(t)
+	}
+	mux.Unlock()
+	refresh()
+	setIsolated(filter)
+}
+
+// unisolate subscribes to the configured topic filters again.
+func unisolate() {
+	setIsolated("")
+}
+
+func setIsolated(filter string) {
+	c, cfg := currentClient()
+	old := activeSubscriptions(cfg)
+	isolateMux.Lock()
+	isolatedFilter = filter
+	isolateMux.Unlock()
+	refresh()
+
+	if c == nil {
+		return
+	}
+	if err := switchSubscriptions(c, old, activeSubscriptions(cfg)); err != nil {
+		log.Println("switching subscriptions failed:", err)
+	}
+}
+
+// switchSubscriptions unsubscribes c from the filters in old and subscribes
+// it to the ones in new.
+func switchSubscriptions(c mqtt.Client, old, new map[string]byte) error {
+	filters := make([]string, 0, len(old))
+	for f := range old {
+		filters = append(filters, f)
+	}
+	if t := c.Unsubscribe(filters...); t.Wait() && t.Error() != nil {
+		return t.Error()
+	}
+	t := c.SubscribeMultiple(new, nil)
+	t.Wait()
+	if t.Error() == nil {
+		checkSubscriptions(t)
+	}
+	return t.Error()
+}
+
+// pruneTo removes all topics from the tree except t, its ancestors and its
+// descendants. The caller must hold mux.
+func pruneTo(t *topic) {
+	for n := t; n.parent != nil; n = n.parent {
+		n.parent.children = map[string]*topic{n.name: n}
+		n.parent.below = n.messages + n.below
+	}
+
+	kept := make(map[*topic]bool)
+	fuzzyTerms = make(map[*topic]string)
+	fuzzyTopics = make(map[string]*topic)
+	encodingCounts = [numEncodings]int{}
+	root.walk(func(n *topic) {
+		kept[n] = true
+		if n.friendlyPayload != nil {
+			term := n.fuzzyTerm()
+			fuzzyTerms[n] = term
+			fuzzyTopics[term] = n
+			encodingCounts[n.encoding]++
+		}
+	})
+	for n := range heldTopics {
+		if !kept[n] {
+			delete(heldTopics, n)
+		}
+	}
+	if !kept[selected] {
+		selected = nil
+	}
+	if !kept[compareA] || compareB != nil && !kept[compareB] {
+		clearComparison()
+	}
+}
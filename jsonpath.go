@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled JSONPath expression. Only the subset needed to pick
+// a single value is supported: the root $, child access by .name or ['name'],
+// where a backslash escapes quotes, and array access by [index].
+type jsonPath struct {
+	expr  string
+	steps []interface{} // string for object keys, int for array indices
+}
+
+func compileJSONPath(expr string) (*jsonPath, error) {
+	p := &jsonPath{expr: expr}
+	rest := strings.TrimSpace(expr)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("%s: must start with $", expr)
+	}
+	rest = rest[1:]
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("%s: empty field name", expr)
+			}
+			p.steps = append(p.steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			if inner := strings.TrimLeft(rest[1:], " "); inner != "" && (inner[0] == '\'' || inner[0] == '"') {
+				key, after, err := readQuotedKey(inner)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", expr, err)
+				}
+				p.steps = append(p.steps, key)
+				rest = after
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: missing ]", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			i, err := strconv.Atoi(inner)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("%s: invalid index [%s]", expr, inner)
+			}
+			p.steps = append(p.steps, i)
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q", expr, rest[0])
+		}
+	}
+	return p, nil
+}
+
+// readQuotedKey reads the quoted key at the start of s up to the closing ],
+// and returns it together with the rest of s. A backslash escapes the next
+// character, such as the quote or another backslash.
+func readQuotedKey(s string) (key, rest string, err error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == quote:
+			after := strings.TrimLeft(s[i+1:], " ")
+			if !strings.HasPrefix(after, "]") {
+				return "", "", fmt.Errorf("missing ] after %c%s%c", quote, b.String(), quote)
+			}
+			return b.String(), after[1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated key %s", s)
+}
+
+// apply evaluates p against the JSON document in payload and returns the
+// selected value as compact JSON.
+func (p *jsonPath) apply(payload []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return "", fmt.Errorf("not JSON")
+	}
+
+	for _, s := range p.steps {
+		switch s := s.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s: no field %s", p.expr, s)
+			}
+			if v, ok = obj[s]; !ok {
+				return "", fmt.Errorf("%s: no field %s", p.expr, s)
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || s >= len(arr) {
+				return "", fmt.Errorf("%s: no index %d", p.expr, s)
+			}
+			v = arr[s]
+		}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
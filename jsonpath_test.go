@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestJSONPath(t *testing.T) {
+	payload := []byte(`{"temperature":21.5,"sensor":{"name":"kitchen","tags":["a","b"]},"odd key":true}`)
+	tests := []struct {
+		expr, want string
+	}{
+		{"$", `{"odd key":true,"sensor":{"name":"kitchen","tags":["a","b"]},"temperature":21.5}`},
+		{"$.temperature", "21.5"},
+		{"$.sensor.name", `"kitchen"`},
+		{"$.sensor.tags[1]", `"b"`},
+		{"$['odd key']", "true"},
+		{"$.sensor['tags'][0]", `"a"`},
+	}
+	for _, tt := range tests {
+		p, err := compileJSONPath(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		got, err := p.apply(payload)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+		} else if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestJSONPathErrors(t *testing.T) {
+	for _, expr := range []string{"temperature", "$.", "$[x]", "$[1", "$..a", "$[-1]"} {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("%s: expected compile error", expr)
+		}
+	}
+
+	p, _ := compileJSONPath("$.a[2]")
+	for _, payload := range []string{`not json`, `{"b":1}`, `{"a":[1]}`, `{"a":{"2":1}}`} {
+		if _, err := p.apply([]byte(payload)); err == nil {
+			t.Errorf("%s: expected error", payload)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+// jsonContainer decodes s if it is a JSON object or array, or returns nil.
+func jsonContainer(s string) interface{} {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return v
+	}
+	return nil
+}
+
+// jsonTree renders the JSON object or array v as a tree whose entries copy
+// their JSONPath to the clipboard when clicked.
+func jsonTree(v interface{}) g.Widget {
+	return g.Layout(jsonNodes(v, "$"))
+}
+
+// jsonNodes returns the entries of the object or array v at path.
+func jsonNodes(v interface{}, path string) []g.Widget {
+	var nodes []g.Widget
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			nodes = append(nodes, jsonNode(k, v[k], jsonPathChild(path, k)))
+		}
+	case []interface{}:
+		for i, e := range v {
+			nodes = append(nodes, jsonNode(strconv.Itoa(i), e, fmt.Sprintf("%s[%d]", path, i)))
+		}
+	}
+	return nodes
+}
+
+func jsonNode(key string, v interface{}, path string) g.Widget {
+	copyPath := func() { g.Context.GetPlatform().SetClipboard(path) }
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		menu := g.ContextMenu().Layout(g.MenuItem("Copy JSON path").OnClick(copyPath))
+		return g.TreeNode(key + "##" + path).
+			Flags(g.TreeNodeFlagsDefaultOpen | g.TreeNodeFlagsSpanAvailWidth).
+			Event(menu.Build).
+			Layout(jsonNodes(v, path)...)
+	}
+	value, _ := json.Marshal(v)
+	return g.Layout{
+		g.Selectable(fmt.Sprintf("%s: %s##%s", key, value, path)).OnClick(copyPath),
+		g.Tooltip("Click to copy " + path),
+	}
+}
+
+var jsonIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonPathChild returns the JSONPath of the field key of the object at path,
+// in a form compileJSONPath accepts.
+func jsonPathChild(path, key string) string {
+	if jsonIdentifier.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key) + "']"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONPathChildCompiles(t *testing.T) {
+	doc := `{"sensor": {"temperature": 21, "rel. humidity": 40, "ids": [7, 8]}}`
+	tests := []struct {
+		path string
+		want string
+	}{
+		{jsonPathChild(jsonPathChild("$", "sensor"), "temperature"), "$.sensor.temperature"},
+		{jsonPathChild(jsonPathChild("$", "sensor"), "rel. humidity"), "$.sensor['rel. humidity']"},
+		{jsonPathChild(jsonPathChild("$", "sensor"), "ids") + "[1]", "$.sensor.ids[1]"},
+	}
+	values := []string{"21", "40", "8"}
+	for i, tt := range tests {
+		if tt.path != tt.want {
+			t.Errorf("path = %s, want %s", tt.path, tt.want)
+		}
+		p, err := compileJSONPath(tt.path)
+		if err != nil {
+			t.Errorf("compileJSONPath(%s): %v", tt.path, err)
+			continue
+		}
+		if got, err := p.apply([]byte(doc)); err != nil || got != values[i] {
+			t.Errorf("%s selects %s, %v, want %s", tt.path, got, err, values[i])
+		}
+	}
+}
+
+func TestJSONPathChildQuotes(t *testing.T) {
+	for _, key := range []string{`it's "quoted"`, `a]b`, `back\slash`, `'`} {
+		doc, _ := json.Marshal(map[string]int{key: 1})
+		path := jsonPathChild("$", key)
+		p, err := compileJSONPath(path)
+		if err != nil {
+			t.Errorf("compileJSONPath(%s): %v", path, err)
+			continue
+		}
+		if got, err := p.apply(doc); err != nil || got != "1" {
+			t.Errorf("%s selects %s, %v, want 1", path, got, err)
+		}
+	}
+}
+
+func TestJSONContainer(t *testing.T) {
+	for _, s := range []string{`{"a":1}`, `[1,2]`} {
+		if jsonContainer(s) == nil {
+			t.Errorf("jsonContainer(%s) = nil", s)
+		}
+	}
+	for _, s := range []string{`1`, `"s"`, `null`, `{`, `on`} {
+		if jsonContainer(s) != nil {
+			t.Errorf("jsonContainer(%s) != nil", s)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+)
+
+var lazyFlag = flag.Int("lazy", 0, "subscribe only to topics with up to this many levels to discover the namespaces of large brokers,\n"+
+	"loading all topics of a namespace on demand from its context menu; 0 subscribes to the topic filters")
+
+var (
+	lazyMux sync.Mutex
+	// loadedNamespaces are the filters of the namespaces loaded with -lazy.
+	loadedNamespaces = make(map[string]bool)
+)
+
+// lazySubscriptions returns the filters to subscribe to with -lazy: the
+// topics with up to -lazy levels below -root, and the loaded namespaces.
+func lazySubscriptions() map[string]byte {
+	subs := make(map[string]byte)
+	levels := make([]string, 0, *lazyFlag)
+	for i := 0; i < *lazyFlag; i++ {
+		levels = append(levels, "+")
+		subs[rootPrefix()+strings.Join(levels, "/")] = byte(*qosFlag)
+	}
+
+	lazyMux.Lock()
+	defer lazyMux.Unlock()
+	for f := range loadedNamespaces {
+		subs[f] = byte(*qosFlag)
+	}
+	return subs
+}
+
+// namespaceLoaded reports whether all topics of the namespace with the
+// subscription filter f are loaded.
+func namespaceLoaded(f string) bool {
+	lazyMux.Lock()
+	defer lazyMux.Unlock()
+	return loadedNamespaces[f]
+}
+
+// setNamespaceLoaded subscribes to or unsubscribes from all topics of the
+// namespace with the subscription filter f. Unloading keeps the topics
+// received so far. It blocks until the broker confirmed the change.
+func setNamespaceLoaded(f string, load bool) {
+	lazyMux.Lock()
+	if load {
+		loadedNamespaces[f] = true
+	} else {
+		delete(loadedNamespaces, f)
+	}
+	lazyMux.Unlock()
+	refresh()
+
+	c, _ := currentClient()
+	if c == nil || isolated() != "" {
+		return
+	}
+	if !load {
+		if t := c.Unsubscribe(f); t.Wait() && t.Error() != nil {
+			log.Println("unsubscribing failed:", t.Error())
+		}
+		return
+	}
+	t := c.SubscribeMultiple(map[string]byte{f: byte(*qosFlag)}, nil)
+	if t.Wait() && t.Error() != nil {
+		log.Println("subscribing failed:", t.Error())
+		return
+	}
+	checkSubscriptions(t)
+}
+
+// namespaceMenu returns the context menu items to load the namespace of t
+// with -lazy. The caller must hold mux.
+func (t *topic) namespaceMenu() g.Widget {
+	if *lazyFlag <= 0 {
+		return g.Layout{}
+	}
+	ns := t.namespace()
+	f := ns.subscriptionFilter()
+	loaded := namespaceLoaded(f)
+	return g.MenuItem("Load all topics of " + ns.name).Selected(loaded).OnClick(func() {
+		go setNamespaceLoaded(f, !loaded)
+	})
+}
+
+// lazyHint returns a hint for the value column of namespaces that are not
+// loaded with -lazy, or nil. The caller must hold mux.
+func (t *topic) lazyHint() g.Widget {
+	if *lazyFlag <= 0 || t.parent != &root || namespaceLoaded(t.subscriptionFilter()) {
+		return nil
+	}
+	return g.Style().SetColor(g.StyleColorText, faded(activityColor, 0.8)).
+		To(g.Label("not loaded, right-click to load all topics"))
+}
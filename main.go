@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -13,12 +14,14 @@ import (
 	"github.com/sahilm/fuzzy"
 	"log"
 	"math"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 )
 
@@ -29,65 +32,538 @@ var (
 	fuzzyTerm   string
 	fuzzyTerms  = make(map[*topic]string)
 	fuzzyTopics = make(map[string]*topic)
+
+	// heldTopics are the topics with a message held back by rate limiting.
+	heldTopics = make(map[*topic]bool)
+
+	// fuzzyDescendants controls whether a matching branch reveals its whole
+	// subtree. When false, only matching leaves (and their ancestors) are shown.
+	fuzzyDescendants = true
+
+	// prefixSearch makes the search input match topic paths by exact prefix
+	// instead of fuzzily.
+	prefixSearch bool
+
+	// segmentSearch makes the search input match space-separated words
+	// against the levels of topic paths, each word matching some level.
+	segmentSearch bool
+
+	// reloadRetained makes clearing the tree request the retained messages
+	// from the broker again.
+	reloadRetained = true
+
+	// updatedWithin hides topics that have not been updated for the given
+	// number of seconds. Zero shows all topics.
+	updatedWithin int32
+
+	// hideEmpty hides topics whose last payload was empty, such as cleared
+	// retained messages, and branches without any values below them.
+	hideEmpty bool
+
+	// numbersOnly hides topics whose value isn't a number, and branches
+	// without any numbers below them.
+	numbersOnly bool
+
+	// freezeTopic keeps the topic column in place while scrolling wide
+	// values horizontally.
+	freezeTopic bool
+
+	// maxDepth collapses branches at this depth of the tree, zero shows
+	// all levels.
+	maxDepth int32
+
+	// shownCount tells how many topics the search and filters left, as
+	// counted by tableRows.
+	shownCount string
+
+	// showRealNames displays the real name next to the alias of aliased
+	// topics and branches.
+	showRealNames bool
+
+	// compactChains shows chains of branches with a single child branch as
+	// one row, like a/b/c.
+	compactChains bool
 )
 
 func loop() {
 	giuStarted = true
+	selectOpenTab()
 
 	g.SingleWindow().Layout(
-		g.InputText(&fuzzyTerm).Hint("Fuzzy search").Size(g.Auto),
-		g.Child().Layout(
-			g.TreeTable().
-				Columns(
-					g.TableColumn("Topic"),
-					g.TableColumn("Value"),
-				).
-				Rows(tableRows()...),
+		g.Row(
+			brokerSwitcher(),
+			g.Label(status()),
+			g.Label(encodingSummary()),
+			g.Label(activeSummary()),
+			g.Condition(waitingToReconnect(), g.Layout{
+				g.SmallButton("Reconnect now").OnClick(triggerReconnect),
+			}, nil),
+			g.Condition(len(deniedFilters()) > 0, g.Layout{
+				g.Style().SetColor(g.StyleColorText, invalidColor).To(
+					g.Label("denied: " + strings.Join(deniedFilters(), ", ")),
+				),
+				g.Tooltip("The broker rejected subscribing to these topic filters, probably because of its access control lists."),
+			}, nil),
+			g.Condition(*rootFlag != "", g.Layout{
+				g.Label("below " + rootPrefix()),
+			}, nil),
+			g.Condition(isolated() != "", g.Layout{
+				g.Label("isolated to " + isolated()),
+				g.SmallButton("Back to everything").OnClick(func() { go unisolate() }),
+			}, nil),
+		),
+		g.Row(
+			g.Checkbox("Include descendants", &fuzzyDescendants),
+			g.Label("Updated within"),
+			g.InputInt(&updatedWithin).Size(80).OnChange(func() {
+				if updatedWithin < 0 {
+					updatedWithin = 0
+				}
+			}),
+			g.Label("s"),
+			g.Label("Max depth"),
+			g.InputInt(&maxDepth).Size(80).OnChange(func() {
+				if maxDepth < 0 {
+					maxDepth = 0
+				}
+			}),
+			g.Checkbox("Hide empty", &hideEmpty),
+			g.Checkbox("Numbers only", &numbersOnly),
+			g.Checkbox("Prefix (Ctrl+P)", &prefixSearch).OnChange(func() { segmentSearch = false }),
+			g.Checkbox("Segments", &segmentSearch).OnChange(func() { prefixSearch = false }),
+			scopeSelector(),
+			g.Custom(func() {
+				// Built after tableRows updated the count.
+				if fuzzyTerm != "" {
+					g.Label(shownCount).Build()
+				}
+			}),
+			g.InputText(&fuzzyTerm).Hint(searchHint()).Size(g.Auto),
+		),
+		g.Row(
+			g.Button("Clear tree").OnClick(func() { clearTree(reloadRetained) }),
+			g.Checkbox("Reload retained", &reloadRetained),
+			g.Button("Save snapshot").OnClick(saveBaseline),
+			g.Button("Copy DOT graph").OnClick(func() { copyDOT(&root) }),
+			g.Button("Copy report").OnClick(copyReport),
+			g.Checkbox("Show changes since snapshot", &showDiff),
+			g.Checkbox("Show throughput", &showThroughput),
+			g.Checkbox("Color namespaces", &colorNamespaces),
+			timestampCombo(),
+			countsCombo(),
+			g.Checkbox("Freeze topic column", &freezeTopic),
+			g.Checkbox("Expand JSON fields", &expandFields),
+			g.Checkbox("Split retained and live", &splitRetained),
+			g.Checkbox("Compact chains", &compactChains),
+			g.Checkbox("Type badges", &showTypeBadges),
+			g.Condition(*logSizeFlag > 0, g.Layout{
+				g.Checkbox("Show message log", &showLog),
+			}, nil),
+			g.Condition(len(config.Aliases) > 0, g.Layout{
+				g.Checkbox("Show real names", &showRealNames),
+			}, nil),
 		),
+		quickSendField(),
+		g.Condition(showThroughput, g.Layout{throughputPlot()}, nil),
+		g.Condition(splitRetained, g.Layout{tabbedTree()}, g.Layout{treeView()}),
+		g.Custom(func() {
+			mux.RLock()
+			defer mux.RUnlock()
+			if *uptimeFlag {
+				updateTitle()
+			}
+			logView().Build()
+			comparisonView().Build()
+			detailView().Build()
+		}),
+	)
+}
+
+// treeView returns the topic tree.
+func treeView() g.Widget {
+	return g.Child().Size(g.Auto, treeHeight()).Layout(
+		treeTable().
+			Columns(tableColumns()...).
+			Rows(tableRows()...),
 	)
 }
 
+// tableColumns returns the columns of the tree. The gauge column comes last,
+// so that rows without gauges need not fill it.
+func tableColumns() []*g.TableColumnWidget {
+	columns := []*g.TableColumnWidget{
+		g.TableColumn("Topic"),
+		g.TableColumn("Value"),
+		g.TableColumn("Last seen"),
+	}
+	if showGauges() {
+		columns = append(columns, g.TableColumn("Gauge"))
+	}
+	return columns
+}
+
+// treeTable returns the table for the topic tree.
+func treeTable() *g.TreeTableWidget {
+	t := g.TreeTable()
+	if freezeTopic {
+		// Frozen columns need the table to scroll by itself. Columns then
+		// fit their content rather than the window.
+		t.Flags(g.TableFlagsBordersV|g.TableFlagsBordersOuterH|g.TableFlagsResizable|g.TableFlagsRowBg|
+			g.TableFlagsNoBordersInBody|g.TableFlagsScrollX|g.TableFlagsScrollY).
+			Freeze(1, 1)
+	}
+	return t
+}
+
+// searchHint returns the hint of the search input for the current mode.
+func searchHint() string {
+	if prefixSearch {
+		return "Topic prefix, e.g. home/livingroom/"
+	}
+	if segmentSearch {
+		return "Words in topic levels, e.g. living temp"
+	}
+	return "Fuzzy search"
+}
+
+func togglePrefixSearch() {
+	prefixSearch = !prefixSearch
+	segmentSearch = false
+}
+
+// copySelected copies topic=value of the selected topic to the clipboard,
+// bound to Ctrl+Shift+V.
+func copySelected() {
+	mux.RLock()
+	defer mux.RUnlock()
+	if selected != nil && selected.last != nil {
+		g.Context.GetPlatform().SetClipboard(selected.topicValue())
+	}
+}
+
+// clearTree removes all topics from the tree. If reload is set, the retained
+// messages are requested from the broker again in the background.
+func clearTree(reload bool) {
+	mux.Lock()
+	root = topic{}
+	fuzzyTerms = make(map[*topic]string)
+	fuzzyTopics = make(map[string]*topic)
+	encodingCounts = [numEncodings]int{}
+	heldTopics = make(map[*topic]bool)
+	selected = nil
+	searchScope = nil
+	clearComparison()
+	mux.Unlock()
+	forgetActivity(nil)
+	refresh()
+
+	if c, cfg := currentClient(); reload && c != nil {
+		go func() {
+			if err := resubscribe(c, cfg); err != nil {
+				log.Println("resubscribe failed:", err)
+			}
+		}()
+	}
+}
+
+// treeHeight returns the height of the tree, leaving room for the comparison
+// and the detail view if they are shown.
+func treeHeight() float32 {
+	h := -comparisonHeight() - logPanelHeight()
+	if selected != nil {
+		h -= 300
+	}
+	if h == 0 {
+		return g.Auto
+	}
+	return h
+}
+
 func tableRows() []*g.TreeTableRowWidget {
+	if showDiff {
+		return diffTableRows()
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+
+	if len(root.children) == 0 {
+		return placeholderRow("No topics yet — waiting for messages")
+	}
+
+	relevant := relevance()
 	if fuzzyTerm != "" {
-		return fuzzyTableRows()
-	} else {
+		shownCount = countShown(relevant)
+	}
+	if relevant == nil {
 		return rootTableRows()
 	}
+
+	topics := root.filter(relevant)
+	if len(topics) == 0 {
+		if fuzzyTerm != "" {
+			return placeholderRow(fmt.Sprintf("No matches for '%s'", fuzzyTerm))
+		}
+		return placeholderRow("No topics match the filters")
+	}
+	var cw []*g.TreeTableRowWidget
+	for _, t := range topics {
+		cw = append(cw, t.tableRow(relevant, 1))
+	}
+	return cw
 }
 
-func fuzzyTableRows() []*g.TreeTableRowWidget {
-	mux.RLock()
-	defer mux.RUnlock()
+// placeholderRow returns a row explaining why the tree is empty.
+func placeholderRow(text string) []*g.TreeTableRowWidget {
+	return []*g.TreeTableRowWidget{
+		g.TreeTableRow(text + "##placeholder").Flags(g.TreeNodeFlagsLeaf),
+	}
+}
+
+// countShown returns "showing X of Y topics" for the leaves in relevant. The
+// caller must hold mux.
+func countShown(relevant map[*topic]int) string {
+	total, shown := 0, 0
+	root.walk(func(t *topic) {
+		if t.children != nil {
+			return
+		}
+		total++
+		if _, ok := relevant[t]; ok || relevant == nil {
+			shown++
+		}
+	})
+	return fmt.Sprintf("showing %d of %d topics", shown, total)
+}
+
+// relevance returns the topics to show with their scores, or nil if all
+// topics are shown. Searches only match topics in the search scope. The
+// caller must hold mux.
+func relevance() map[*topic]int {
+	var relevant map[*topic]int
+	if fuzzyTerm != "" {
+		if prefixSearch {
+			relevant = prefixRelevance(fuzzyTerm)
+		} else if segmentSearch {
+			relevant = segmentRelevance(fuzzyTerm)
+		} else if fuzzyDescendants {
+			relevant = subtreeRelevance(fuzzyTerm)
+		} else {
+			relevant = leafRelevance(fuzzyTerm)
+		}
+	}
+	if updatedWithin > 0 {
+		relevant = updatedSince(relevant, time.Now().Add(-time.Duration(updatedWithin)*time.Second))
+	}
+	if hideEmpty {
+		relevant = withValues(relevant)
+	}
+	if numbersOnly {
+		relevant = withNumbers(relevant)
+	}
+	return inCurrentTab(relevant)
+}
+
+// updatedSince narrows relevant down to leaves updated after since, and their
+// ancestors. A nil relevant map considers all topics.
+func updatedSince(relevant map[*topic]int, since time.Time) map[*topic]int {
+	return narrow(relevant, func(t *topic) bool { return t.lastSeen.After(since) })
+}
+
+// withValues narrows relevant down to leaves with a non-empty payload, and
+// their ancestors. A nil relevant map considers all topics.
+func withValues(relevant map[*topic]int) map[*topic]int {
+	return narrow(relevant, func(t *topic) bool { return t.last != nil && len(t.last.Payload()) > 0 })
+}
+
+// withNumbers narrows relevant down to leaves whose value is a finite number,
+// and their ancestors. A nil relevant map considers all topics.
+func withNumbers(relevant map[*topic]int) map[*topic]int {
+	return narrow(relevant, func(t *topic) bool { return t.last != nil && isNumber(t.value()) })
+}
+
+// isNumber reports whether s is a finite decimal number. ParseFloat also
+// accepts NaN, infinities and hex floats, which don't count for withNumbers.
+func isNumber(s string) bool {
+	v, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) && !strings.ContainsAny(s, "xX")
+}
 
+// narrow narrows relevant down to the leaves keep returns true for, and their
+// ancestors. A nil relevant map considers all topics.
+func narrow(relevant map[*topic]int, keep func(*topic) bool) map[*topic]int {
+	kept := make(map[*topic]int)
+	root.walk(func(t *topic) {
+		if t.children != nil || !keep(t) {
+			return
+		}
+		if relevant == nil {
+			markRelevant(kept, t, 0)
+		} else if score, ok := relevant[t]; ok {
+			markRelevant(kept, t, score)
+		}
+	})
+	return kept
+}
+
+// prefixRelevance makes all topics starting with prefix relevant, together
+// with their ancestors.
+func prefixRelevance(prefix string) map[*topic]int {
+	relevant := make(map[*topic]int)
+	searchRoot().walk(func(t *topic) {
+		if t.last != nil && strings.HasPrefix(t.path(), prefix) {
+			markRelevant(relevant, t, 0)
+		}
+	})
+	return relevant
+}
+
+// segmentRelevance makes the topics relevant whose levels contain each of the
+// space-separated words of terms, ignoring case, together with their
+// ancestors. Topics whose matching levels are closer to the words score
+// higher.
+func segmentRelevance(terms string) map[*topic]int {
+	words := strings.Fields(strings.ToLower(terms))
+	relevant := make(map[*topic]int)
+	searchRoot().walk(func(t *topic) {
+		if t.last == nil {
+			return
+		}
+		var levels []string
+		for _, a := range append(t.ancestors(), t) {
+			if a.parent != nil {
+				levels = append(levels, strings.ToLower(a.name))
+			}
+		}
+		if score, ok := matchSegments(words, levels); ok {
+			markRelevant(relevant, t, score)
+		}
+	})
+	return relevant
+}
+
+// matchSegments reports whether each word is contained in one of levels. The
+// score is the negated number of characters of the best matching levels not
+// covered by their words.
+func matchSegments(words, levels []string) (int, bool) {
+	score := 0
+	for _, w := range words {
+		best := -1
+		for _, l := range levels {
+			if strings.Contains(l, w) && (best < 0 || len(l)-len(w) < best) {
+				best = len(l) - len(w)
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		score -= best
+	}
+	return score, true
+}
+
+// leafRelevance matches term against the leaves only. Branches are relevant
+// if any of their leaves match.
+func leafRelevance(term string) map[*topic]int {
 	var terms []string
-	for _, t := range fuzzyTerms {
-		terms = append(terms, t)
+	for t, s := range fuzzyTerms {
+		if inSearchScope(t) {
+			terms = append(terms, s)
+		}
 	}
 
-	fm := fuzzy.Find(fuzzyTerm, terms)
+	fm := fuzzy.Find(term, terms)
 	relevant := make(map[*topic]int)
 
 	for _, m := range fm {
-		leaf := fuzzyTopics[m.Str]
-		relevant[leaf] = m.Score
-		for _, a := range leaf.ancestors() {
-			// Mark ancestors as relevant, keeping track of their highest score.
-			if s, ok := relevant[a]; ok {
-				if m.Score > s {
-					relevant[a] = m.Score
-				}
-			} else {
-				relevant[a] = m.Score
+		markRelevant(relevant, fuzzyTopics[m.Str], m.Score)
+	}
+	return relevant
+}
+
+// subtreeRelevance matches term against leaves and branch paths. A matching
+// branch makes all of its descendants relevant, too.
+func subtreeRelevance(term string) map[*topic]int {
+	var terms []string
+	var nodes []*topic
+	for t, s := range fuzzyTerms {
+		if inSearchScope(t) {
+			terms = append(terms, s)
+			nodes = append(nodes, t)
+		}
+	}
+	searchRoot().walk(func(t *topic) {
+		if t.children != nil {
+			terms = append(terms, t.path())
+			nodes = append(nodes, t)
+		}
+	})
+
+	fm := fuzzy.Find(term, terms)
+	relevant := make(map[*topic]int)
+
+	for _, m := range fm {
+		node := nodes[m.Index]
+		markRelevant(relevant, node, m.Score)
+		node.walk(func(d *topic) {
+			if s, ok := relevant[d]; !ok || m.Score > s {
+				relevant[d] = m.Score
+			}
+		})
+	}
+	return relevant
+}
+
+// markRelevant marks t and its ancestors as relevant, keeping track of their
+// highest score.
+func markRelevant(relevant map[*topic]int, t *topic, score int) {
+	for _, a := range append(t.ancestors(), t) {
+		if s, ok := relevant[a]; ok {
+			if score > s {
+				relevant[a] = score
 			}
+		} else {
+			relevant[a] = score
 		}
 	}
+}
 
-	topics := root.filter(relevant)
-	var cw []*g.TreeTableRowWidget
-	for _, t := range topics {
-		cw = append(cw, t.tableRow(relevant))
+// find returns the node of topic below t, or nil if it doesn't exist. The
+// topic includes -root.
+func (t *topic) find(topic string) *topic {
+	topic, ok := belowRoot(topic)
+	if !ok {
+		return nil
 	}
-	return cw
+	for _, s := range splitTopic(topic) {
+		if t = t.children[s.name]; t == nil {
+			return nil
+		}
+	}
+	return t
+}
+
+// walk calls fn for every descendant of t.
+func (t *topic) walk(fn func(*topic)) {
+	for _, c := range t.children {
+		fn(c)
+		c.walk(fn)
+	}
+}
+
+// path returns the topic path of t, which is also valid for branches that
+// never received a message.
+func (t *topic) path() string {
+	var b strings.Builder
+	for _, a := range append(t.ancestors(), t) {
+		if a.parent != nil {
+			if a.parent.parent != nil {
+				b.WriteString(a.sep)
+			}
+			b.WriteString(a.name)
+		}
+	}
+	return b.String()
 }
 
 func (t *topic) ancestors() []*topic {
@@ -103,63 +579,292 @@ func (t *topic) ancestors() []*topic {
 }
 
 func rootTableRows() []*g.TreeTableRowWidget {
-	mux.RLock()
 	keys := make([]string, 0, len(root.children))
 	for k := range root.children {
 		keys = append(keys, k)
 	}
-	sort.Strings(keys)
+	sortNamespaces(keys)
 	var cw []*g.TreeTableRowWidget
 	for _, k := range keys {
-		cw = append(cw, root.children[k].tableRow(nil))
+		cw = append(cw, root.children[k].tableRow(nil, 1))
 	}
-	mux.RUnlock()
 	return cw
 }
 
+// sortNamespaces sorts the names of top-level namespaces in the configured
+// order, the rest alphabetically.
+func sortNamespaces(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		if ri, rj := namespaceRank(names[i]), namespaceRank(names[j]); ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+}
+
 type topic struct {
 	parent          *topic
 	name            string
+	sep             string // delimiter between the parent and name in the topic
 	children        map[string]*topic
 	last            mqtt.Message
 	friendlyPayload *string
+	lastSeen        time.Time
+	unit            string
+	alias           string
+	transform       *transformRule
+	transformed     string
+	schema          *schemaRule
+	schemaError     string
+	sizes           [sizeBuckets]int
+	messages        int
+	below           int // messages of all descendants
+	numbers         numericStats
+	encoding        encoding
+
+	// compressed notes how the last payload was decompressed for display,
+	// empty if it was not compressed.
+	compressed string
+
+	// firstRetained is set if the first message of the topic was retained.
+	firstRetained bool
+
+	// dedup makes update ignore payloads equal to the last one, counting
+	// them in duplicates instead.
+	dedup      bool
+	duplicates int
+
+	// maxRate limits how many messages per second are shown. Messages
+	// arriving faster are counted, but only the last one is shown once the
+	// topic may be updated again at shownAt plus 1/maxRate.
+	maxRate float64
+	shownAt time.Time
+	held    mqtt.Message
+
+	// changedAt is when the shown value last changed. If the value changed
+	// from one number to another, delta is the difference.
+	changedAt time.Time
+	delta     float64
+	hasDelta  bool
+
+	// fieldsExpanded shows the fields of a JSON object payload as rows
+	// below the topic.
+	fieldsExpanded bool
+
+	// unwrapped is the value of a JSON object wrapping a single value, see
+	// -unwrap.
+	unwrapped *string
+
+	// recent are the last -recent-values values, oldest first.
+	recent []timedValue
 }
 
-func (t *topic) tableRow(filter map[*topic]int) *g.TreeTableRowWidget {
+// tableRow returns the row of t at the given depth in the tree, the children
+// of the root being at depth 1. Branches at maxDepth are collapsed into a
+// summary of the topics below them.
+func (t *topic) tableRow(filter map[*topic]int, depth int) *g.TreeTableRowWidget {
+	if t.children == nil && t.last == nil {
+		return t.seededRow()
+	}
 	if t.children == nil {
-		var value string
-		if t.friendlyPayload != nil {
-			value = *t.friendlyPayload
+		value := t.value()
+		display := value
+		if t.unit != "" {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				display = value + " " + t.unit
+			}
+		}
+		short := preview(display, *previewLenFlag)
+		var vl g.Widget = g.Selectable(imguiText(short) + "##" + t.last.Topic()).
+			Selected(t == selected).
+			OnClick(func() { selected = t })
+		if short != display {
+			vl = g.Layout{vl, g.Tooltip(display)}
+		}
+		vl = t.flashing(vl, time.Now())
+		vl = t.typeBadge(vl)
+		vl = t.compressedBadge(vl)
+		if t.schemaError != "" {
+			vl = g.Row(
+				g.Style().SetColor(g.StyleColorText, invalidColor).To(g.Label("invalid")),
+				g.Tooltip(t.schemaError),
+				vl,
+			)
 		}
-		vl := g.Label(value)
-		return g.TreeTableRow(t.name,
-			vl, g.ContextMenu().MouseButton(g.MouseButtonRight).Layout(
+		vl = t.dimmed(vl, time.Now())
+		cells := []g.Widget{
+			t.tinted(vl), g.ContextMenu().MouseButton(g.MouseButtonRight).Layout(
 				g.MenuItem("Copy value").OnClick(func() { g.Context.GetPlatform().SetClipboard(value) }),
 				g.MenuItem("Copy topic").OnClick(func() { g.Context.GetPlatform().SetClipboard(t.last.Topic()) }),
+				g.MenuItem("Copy topic=value").OnClick(func() { g.Context.GetPlatform().SetClipboard(t.topicValue()) }),
+				g.MenuItem("Copy subscription filter").OnClick(func() { g.Context.GetPlatform().SetClipboard(t.subscriptionFilter()) }),
+				g.MenuItem("Copy hexdump").OnClick(func() { g.Context.GetPlatform().SetClipboard(hexdump(t.last.Payload())) }),
+				g.MenuItem(fmt.Sprintf("Copy last %d values as CSV", len(t.recent))).OnClick(func() { copyRecent(t) }),
+				g.MenuItem("Mark for comparison").OnClick(func() { markForComparison(t) }),
+				g.MenuItem("Pin log to topic").OnClick(func() { pinLog(t.subscriptionFilter()) }),
+				g.MenuItem("Expand JSON fields").Selected(t.fieldsExpanded).OnClick(func() { toggleFields(t) }),
+				t.tagMenu(),
 			),
-		).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsLeaf)
-	} else {
-		if filter == nil {
-			keys := make([]string, 0, len(t.children))
-			for k := range t.children {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
+			t.dimmed(t.withCount(t.activityBadge(g.Label(formatLastSeen(t.lastSeen, time.Now())), time.Now())), time.Now()),
+		}
+		if showGauges() {
+			cells = append(cells, t.gauge())
+		}
+		row := g.TreeTableRow(rowLabel(t.label(), t.name), t.aliasTooltip(cells...)...).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsLeaf)
+		if fields := t.fieldRows(); len(fields) > 0 {
+			row.Flags(g.TreeNodeFlagsSpanAvailWidth).Children(fields...)
+		}
+		return row
+	}
 
-			var cw []*g.TreeTableRowWidget
-			for _, k := range keys {
-				cw = append(cw, t.children[k].tableRow(filter))
-			}
-			return g.TreeTableRow(t.name).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsDefaultOpen).Children(cw...)
-		} else {
-			relevant := t.filter(filter)
-			var cw []*g.TreeTableRowWidget
-			for _, rc := range relevant {
-				cw = append(cw, rc.tableRow(filter))
-			}
-			return g.TreeTableRow(t.name).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsDefaultOpen).Children(cw...)
+	if maxDepth > 0 && depth >= int(maxDepth) {
+		return g.TreeTableRow(rowLabel(t.label(), t.name), t.aliasTooltip(
+			t.tinted(g.Label(fmt.Sprintf("(… %d deeper topics)", t.countLeaves(filter)))), t.branchMenu(),
+		)...).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsLeaf)
+	}
+
+	n, label, skipped := t.compactChain(filter, depth)
+	var cw []*g.TreeTableRowWidget
+	for _, c := range n.shownChildren(filter) {
+		cw = append(cw, c.tableRow(filter, depth+skipped+1))
+	}
+	return g.TreeTableRow(rowLabel(label, t.name), n.aliasTooltip(
+		n.tinted(t.lazyHint()), n.branchMenu(),
+	)...).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsDefaultOpen).Children(cw...)
+}
+
+// shownChildren returns the children of t to show, sorted by name or by
+// relevance if filter is given.
+func (t *topic) shownChildren(filter map[*topic]int) []*topic {
+	if filter != nil {
+		return t.filter(filter)
+	}
+	keys := make([]string, 0, len(t.children))
+	for k := range t.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	children := make([]*topic, len(keys))
+	for i, k := range keys {
+		children[i] = t.children[k]
+	}
+	return children
+}
+
+// compactChain returns the branch ending the chain of branches that start at
+// the branch t at depth and have only one branch as their child, if
+// compactChains is set, together with the row label joining their names and
+// the number of levels skipped. Chains end before maxDepth is reached.
+func (t *topic) compactChain(filter map[*topic]int, depth int) (*topic, string, int) {
+	n, label, skipped := t, t.label(), 0
+	for compactChains {
+		children := n.shownChildren(filter)
+		if len(children) != 1 || children[0].children == nil {
+			break
+		}
+		if maxDepth > 0 && depth+skipped+1 >= int(maxDepth) {
+			break
+		}
+		n = children[0]
+		label += n.sep + n.label()
+		skipped++
+	}
+	return n, label, skipped
+}
+
+func (t *topic) branchMenu() g.Widget {
+	return g.ContextMenu().MouseButton(g.MouseButtonRight).Layout(
+		g.MenuItem("Copy subscription filter").OnClick(func() { g.Context.GetPlatform().SetClipboard(t.subscriptionFilter()) }),
+		g.MenuItem("Isolate subtree").OnClick(func() { go isolate(t, false) }),
+		g.MenuItem("Isolate subtree and clear the rest").OnClick(func() { go isolate(t, true) }),
+		g.MenuItem("Pin log to subtree").OnClick(func() { pinLog(t.subscriptionFilter()) }),
+		g.MenuItem("Copy subtree as DOT graph").OnClick(func() { copyDOT(t) }),
+		g.MenuItem("Search in subtree").OnClick(func() { setSearchScope(t) }),
+		t.namespaceMenu(),
+		t.tagMenu(),
+	)
+}
+
+// countLeaves returns the number of topics below t that are shown with
+// filter.
+func (t *topic) countLeaves(filter map[*topic]int) int {
+	n := 0
+	t.walk(func(c *topic) {
+		if _, ok := filter[c]; c.children == nil && (filter == nil || ok) {
+			n++
+		}
+	})
+	return n
+}
+
+// value returns the value of a leaf as shown in the tree.
+func (t *topic) value() string {
+	if t.transform != nil {
+		return t.transformed
+	} else if t.unwrapped != nil {
+		return *t.unwrapped
+	} else if t.friendlyPayload != nil {
+		return *t.friendlyPayload
+	}
+	return ""
+}
+
+// preview shortens s to at most n characters, ending it with an ellipsis if
+// it was cut. Zero n disables shortening.
+func preview(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// subscriptionFilter returns the topic filter to subscribe to t: the received
+// topic of a leaf, or the path of a branch followed by /#. Branches split by
+// a custom delimiter widen to the enclosing topic level.
+func (t *topic) subscriptionFilter() string {
+	if t.children == nil {
+		if t.last != nil {
+			return t.last.Topic()
+		}
+		return t.topicPath()
+	}
+	newLevels := true
+	for _, c := range t.children {
+		if c.sep != "/" {
+			newLevels = false
+			break
 		}
 	}
+	if newLevels {
+		return t.topicPath() + "/#"
+	}
+	// Some children don't start new topic levels, subscribe to the closest
+	// level containing all of them instead.
+	if i := strings.LastIndex(t.topicPath(), "/"); i >= 0 {
+		return t.topicPath()[:i] + "/#"
+	}
+	return "#"
+}
+
+// label returns the name displayed for t in the tree.
+func (t *topic) label() string {
+	if t.alias == "" {
+		return levelName(t.name)
+	} else if showRealNames {
+		return fmt.Sprintf("%s (%s)", t.alias, levelName(t.name))
+	}
+	return t.alias
+}
+
+// aliasTooltip returns the widgets of a row, preceded by a tooltip showing
+// the real topic path of aliased topics and branches.
+func (t *topic) aliasTooltip(widgets ...g.Widget) []g.Widget {
+	if t.alias == "" {
+		return widgets
+	}
+	return append([]g.Widget{g.Tooltip(t.path())}, widgets...)
 }
 
 func (t *topic) filter(filter map[*topic]int) []*topic {
@@ -175,6 +880,11 @@ func (t *topic) filter(filter map[*topic]int) []*topic {
 	}
 	sort.Slice(relevant, func(i, j int) bool {
 		if relevant[i].score == relevant[j].score {
+			if t == &root {
+				if ri, rj := namespaceRank(relevant[i].child.name), namespaceRank(relevant[j].child.name); ri != rj {
+					return ri < rj
+				}
+			}
 			return strings.Compare(relevant[i].child.name, relevant[j].child.name) == 1
 		} else {
 			return relevant[i].score > relevant[j].score
@@ -187,58 +897,242 @@ func (t *topic) filter(filter map[*topic]int) []*topic {
 	return sorted
 }
 
+// topicValue returns the topic of a leaf and its value as shown in the tree,
+// joined by =.
+func (t *topic) topicValue() string {
+	return t.last.Topic() + "=" + t.value()
+}
+
 func (t *topic) fuzzyTerm() string {
 	return fmt.Sprintf("%s=%s", t.last.Topic(), *t.friendlyPayload)
 }
 
-func (t *topic) update(parts []string, msg mqtt.Message) {
+// update adds msg to the tree below t, parts being the levels of its topic
+// left. It returns the payload of msg decoded for display, so that it needs
+// to be decoded only once.
+func (t *topic) update(parts []segment, msg mqtt.Message) string {
 	if len(parts) == 0 {
-		if t.friendlyPayload != nil {
-			oldTerm := t.fuzzyTerm()
-			delete(fuzzyTopics, oldTerm)
+		if t.deletesRetained(msg) {
+			t.remove()
+			return emptyPayload
+		}
+		latest := t.last
+		if t.held != nil {
+			latest = t.held
+		}
+		if t.dedup && latest != nil && bytes.Equal(msg.Payload(), latest.Payload()) {
+			t.duplicates++
+			s, _, _ := decodeMessage(msg)
+			return s
 		}
 
-		t.last = msg
-		s := sanitize(msg.Payload())
-		t.friendlyPayload = &s
+		if t.last == nil {
+			t.dedup = dedupFor(msg.Topic())
+			t.maxRate = rateFor(msg.Topic())
+			t.unit = unitFor(msg.Topic())
+			t.transform = transformFor(msg.Topic())
+			t.schema = schemaFor(msg.Topic())
+			t.firstRetained = msg.Retained()
+		}
+		now := time.Now()
+		t.lastSeen = now
+		t.sizes[sizeBucket(len(msg.Payload()))]++
+		t.messages++
+		t.addBelow(1)
 
-		newTerm := t.fuzzyTerm()
-		fuzzyTerms[t] = newTerm
-		fuzzyTopics[newTerm] = t
+		if t.last != nil && t.maxRate > 0 && now.Sub(t.shownAt) < time.Duration(float64(time.Second)/t.maxRate) {
+			// Hold the message back until showHeld runs.
+			t.held = msg
+			heldTopics[t] = true
+			decoded, enc, _ := decodeMessage(msg)
+			value := decoded
+			if t.transform != nil {
+				value = t.transform.apply(msg.Payload())
+			} else if u, ok := unwrap(value, enc); ok {
+				value = u
+			}
+			t.countNumber(msg.Topic(), value)
+			t.remember(now, value)
+			return decoded
+		}
+		t.show(msg, now)
+		t.countNumber(msg.Topic(), t.value())
+		t.remember(now, t.value())
+		return *t.friendlyPayload
 	} else {
 		if t.children == nil {
 			t.children = make(map[string]*topic)
 		}
 
-		name := parts[0]
+		name := parts[0].name
 		rest := parts[1:]
 
 		ct, ok := t.children[name]
 		if !ok {
-			ct = &topic{parent: t, name: name}
+			ct = &topic{parent: t, name: name, sep: parts[0].sep}
+			ct.alias = aliasFor(ct.topicPath())
 			t.children[name] = ct
 		}
-		ct.update(rest, msg)
+		return ct.update(rest, msg)
 	}
 }
 
+// show makes msg the message displayed for the leaf t.
+func (t *topic) show(msg mqtt.Message, now time.Time) {
+	if t.friendlyPayload != nil {
+		delete(fuzzyTopics, t.fuzzyTerm())
+	}
+	prev, hadValue := t.value(), t.friendlyPayload != nil
+	t.last = msg
+	t.shownAt = now
+	if t.held != nil {
+		t.held = nil
+		delete(heldTopics, t)
+	}
+
+	s, enc, note := decodeMessage(msg)
+	t.friendlyPayload = &s
+	t.setEncoding(enc)
+	t.compressed = note
+	t.unwrapped = nil
+	if u, ok := unwrap(s, enc); ok {
+		t.unwrapped = &u
+	}
+	if t.transform != nil {
+		t.transformed = t.transform.apply(msg.Payload())
+	}
+	if t.schema != nil {
+		t.schemaError = t.schema.validate(msg.Payload())
+	}
+
+	t.recordChange(prev, hadValue, now)
+
+	newTerm := t.fuzzyTerm()
+	fuzzyTerms[t] = newTerm
+	fuzzyTopics[newTerm] = t
+}
+
+// showHeld shows the messages held back by rate limiting on topics that may
+// be updated again.
+func showHeld() {
+	mux.Lock()
+	defer mux.Unlock()
+	now := time.Now()
+	for t := range heldTopics {
+		if now.Sub(t.shownAt) >= time.Duration(float64(time.Second)/t.maxRate) {
+			t.show(t.held, now)
+		}
+	}
+}
+
+// countNumber adds value to the numeric stats and history of t, if it is a
+// number.
+func (t *topic) countNumber(topic, value string) {
+	if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		t.numbers.add(v)
+		recordHistory(topic, v)
+	}
+}
+
+// decodeMessage decodes the payload of msg for display. The note says how
+// the payload was decompressed, if it was.
+func decodeMessage(msg mqtt.Message) (s string, enc encoding, note string) {
+	if *rawFlag {
+		return raw(msg.Payload()), encodingRaw, ""
+	}
+	if *sparkplugFlag && isSparkplugTopic(msg.Topic()) {
+		if sp, err := decodeSparkplug(msg.Payload()); err == nil {
+			return sp, encodingSparkplug, ""
+		}
+	}
+	if r := csvFor(msg.Topic()); r != nil {
+		if s, ok := decodeCSV(msg.Payload(), r); ok {
+			return s, encodingCSV, ""
+		}
+	}
+	return decodeNoted(msg.Payload())
+}
+
+// raw returns payload as text without any decoding. Only invalid UTF-8 and
+// control characters other than newlines and tabs are escaped as \xNN.
+func raw(payload []byte) string {
+	if max := *maxPayloadDisplayFlag; max > 0 && len(payload) > max {
+		return fmt.Sprintf("%s (%d bytes, truncated)", raw(payload[:cutAt(payload, max)]), len(payload))
+	}
+
+	var b strings.Builder
+	for len(payload) > 0 {
+		r, n := utf8.DecodeRune(payload)
+		switch {
+		case r == utf8.RuneError && n <= 1, r < 0x20 && r != '\n' && r != '\t', r == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", payload[0])
+			n = 1
+		default:
+			b.Write(payload[:n])
+		}
+		payload = payload[n:]
+	}
+	return b.String()
+}
+
 func sanitize(payload []byte) string {
-	var jsonObject map[string]interface{}
-	if err := json.Unmarshal(payload, &jsonObject); err == nil {
-		return string(payload)
+	s, _ := decode(payload)
+	return s
+}
+
+// emptyPayload is shown for empty payloads, which also clear retained
+// messages.
+const emptyPayload = "<empty>"
+
+// decode is like sanitize, but also reports how payload was decoded. Gzip
+// and zlib framed payloads are decompressed first.
+func decode(payload []byte) (string, encoding) {
+	s, enc, _ := decodeNoted(payload)
+	return s, enc
+}
+
+// decodeNoted is like decode, but also returns the note of decodeCompressed
+// if payload was decompressed.
+func decodeNoted(payload []byte) (s string, enc encoding, note string) {
+	if len(payload) == 0 {
+		return emptyPayload, encodingText, ""
 	}
+	if s, enc, note, ok := decodeCompressed(payload); ok {
+		return s, enc, note
+	}
+	s, enc = decodePlain(payload)
+	return s, enc, ""
+}
+
+// decodePlain is like decode, but never decompresses payload. JSON is kept
+// whole however large, since fields, schemas and JSONPath need all of it.
+// Other payloads over -max-payload-display are decoded and shown only in
+// part.
+func decodePlain(payload []byte) (string, encoding) {
+	if s, enc, ok := decodeJSON(payload); ok {
+		return s, enc
+	}
+	if max := *maxPayloadDisplayFlag; max > 0 && len(payload) > max {
+		s, enc := decodeUnstructured(payload[:cutAt(payload, max)])
+		return fmt.Sprintf("%s (%d bytes, truncated)", s, len(payload)), enc
+	}
+	return decodeUnstructured(payload)
+}
+
+// decodeUnstructured decodes payload that isn't JSON.
+func decodeUnstructured(payload []byte) (string, encoding) {
 
 	if utf8.Valid(payload) {
 		possibleString := string(payload)
 
 		if possibleString == "true" {
-			return "true"
+			return "true", encodingBool
 		} else if possibleString == "false" {
-			return "false"
+			return "false", encodingBool
 		}
 
 		if _, err := strconv.ParseFloat(possibleString, 64); err == nil {
-			return possibleString
+			return possibleString, encodingNumber
 		}
 
 		allGraphic := true
@@ -249,77 +1143,415 @@ func sanitize(payload []byte) string {
 			}
 		}
 		if allGraphic {
-			return fmt.Sprintf("%q", possibleString)
+			return fmt.Sprintf("%q", possibleString), encodingText
 		}
 	}
 
+	if s, ok := decodeUTF16(payload, *utf16Flag); ok {
+		return fmt.Sprintf("%q", s), encodingText
+	}
+
 	var floatValue float64
 	reader := bytes.NewReader(payload)
 	if err := binary.Read(reader, binary.LittleEndian, &floatValue); err == nil {
-		// Checking if it's a valid float (not NaN or Inf)
+		// NaN and Inf are more likely integers or other binary data, unless
+		// asked for.
 		if !math.IsNaN(floatValue) && !math.IsInf(floatValue, 0) {
-			return fmt.Sprintf("%f", floatValue)
+			return fmt.Sprintf("%f", floatValue), encodingBinary
+		} else if *floatSpecialFlag {
+			return formatSpecialFloat(floatValue), encodingBinary
 		}
 	}
 
 	_, _ = reader.Seek(0, 0) // Resetting reader
 	var intValue int32
 	if err := binary.Read(reader, binary.LittleEndian, &intValue); err == nil {
-		return fmt.Sprintf("%d", intValue)
+		return fmt.Sprintf("%d", intValue), encodingBinary
 	}
 
+	return formatBinary(payload), encodingBinary
+}
+
+// formatBinary formats payload that could not be decoded otherwise as set by
+// -binary-format.
+func formatBinary(payload []byte) string {
+	if *binaryFormatFlag == "base64" {
+		return base64.StdEncoding.EncodeToString(payload)
+	}
 	return fmt.Sprintf("%#x", payload)
 }
 
+// decodeJSON returns payload as it is if it is any valid JSON value. Objects
+// and arrays keep their formatting, other values are trimmed of surrounding
+// white space. Numbers and booleans keep their own encodings.
+func decodeJSON(payload []byte) (string, encoding, bool) {
+	if !json.Valid(payload) {
+		return "", encodingNone, false
+	}
+	trimmed := bytes.TrimSpace(payload)
+	switch trimmed[0] {
+	case '{', '[':
+		return string(payload), encodingJSON, true
+	case 't', 'f':
+		return string(trimmed), encodingBool, true
+	case '"', 'n':
+		return string(trimmed), encodingJSON, true
+	}
+	return string(trimmed), encodingNumber, true
+}
+
+// formatSpecialFloat formats NaN and infinite values.
+func formatSpecialFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return "NaN"
+}
+
+// decodeUTF16 decodes payload as UTF-16 text if it starts with a byte order
+// mark. Without one, payload is decoded as UTF-16LE if assumeLE is set. Only
+// text consisting of graphic characters is accepted.
+func decodeUTF16(payload []byte, assumeLE bool) (string, bool) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(payload, []byte{0xff, 0xfe}):
+		order, payload = binary.LittleEndian, payload[2:]
+	case bytes.HasPrefix(payload, []byte{0xfe, 0xff}):
+		order, payload = binary.BigEndian, payload[2:]
+	case assumeLE:
+		order = binary.LittleEndian
+	default:
+		return "", false
+	}
+	if len(payload) == 0 || len(payload)%2 != 0 {
+		return "", false
+	}
+
+	units := make([]uint16, len(payload)/2)
+	for i := range units {
+		units[i] = order.Uint16(payload[2*i:])
+	}
+	runes := utf16.Decode(units)
+	for _, r := range runes {
+		if r == utf8.RuneError || !unicode.IsGraphic(r) {
+			return "", false
+		}
+	}
+	return string(runes), true
+}
+
+// cutAt returns the largest index not greater than max that does not split a
+// UTF-8 encoded rune in payload.
+func cutAt(payload []byte, max int) int {
+	for i := max; i > 0 && i > max-utf8.UTFMax; i-- {
+		if utf8.RuneStart(payload[i]) {
+			return i
+		}
+	}
+	return max
+}
+
+// segment is a level of the tree, preceded by the delimiter sep in the topic.
+type segment struct {
+	sep, name string
+}
+
+// splitTopic splits topic into the levels of the tree at -delimiter, and
+// then each level at -segment-delimiter if given.
+func splitTopic(topic string) []segment {
+	var parts []segment
+	for _, level := range strings.Split(topic, *delimiterFlag) {
+		sep := *delimiterFlag
+		if *segmentDelimiterFlag != "" {
+			for _, name := range strings.Split(level, *segmentDelimiterFlag) {
+				parts = append(parts, segment{sep, name})
+				sep = *segmentDelimiterFlag
+			}
+		} else {
+			parts = append(parts, segment{sep, level})
+		}
+	}
+	return parts
+}
+
 func defaultHandler(_ mqtt.Client, msg mqtt.Message) {
 	//log.Println("received", msg.Topic())
-	parts := strings.Split(msg.Topic(), "/")
+	if *snapshotFlag && !msg.Retained() {
+		return
+	}
+
+	topic, ok := belowRoot(unshare(msg.Topic()))
+	if !ok {
+		return
+	}
+
+	countMessage()
+	touchIdle(time.Now())
+	parts := splitTopic(topic)
 
 	mux.Lock()
-	root.update(parts, msg)
+	value := root.update(parts, msg)
+	recordLog(msg, value, time.Now())
+	forwardMessage(msg)
 	mux.Unlock()
 
-	if giuStarted {
-		g.Update()
-	}
+	refresh()
 }
 
 var (
-	brokerFlag   = flag.String("broker", "tcp://test.mosquitto.org:1883", "broker to explore (scheme://host:port)")
 	clientIDFlag = flag.String("client-id", "", "client ID, leave empty to generate one")
+	usernameFlag = flag.String("username", "", "username for authentication")
+	passwordFlag = flag.String("password", "", "password for authentication")
+	snapshotFlag = flag.Bool("snapshot", false, "print retained messages as JSON and exit instead of opening a window")
+	settleFlag   = flag.Duration("snapshot-settle", 2*time.Second, "time to wait for retained messages in snapshot mode")
+	getFlag      = flag.String("get", "", "print the decoded values of the topics matching this filter received within -snapshot-settle and exit")
+
+	delimiterFlag        = flag.String("delimiter", "/", "split topics into tree levels at this delimiter")
+	segmentDelimiterFlag = flag.String("segment-delimiter", "", "split tree levels further at this delimiter, e.g. . or -")
+
+	utf16Flag             = flag.Bool("utf16", false, "decode non UTF-8 payloads without byte order mark as UTF-16LE text")
+	floatSpecialFlag      = flag.Bool("float-special", false, "show binary float payloads that are NaN or infinite as NaN, +Inf or -Inf instead of as integers")
+	rawFlag               = flag.Bool("raw", false, "show payloads as they are instead of decoding them, escaping only bytes that can't be displayed")
+	binaryFormatFlag      = flag.String("binary-format", "hex", "show payloads that can't be decoded as hex or base64")
+	previewLenFlag        = flag.Int("preview-len", 80, "shorten values in the tree to this many characters, 0 shows them in full")
+	maxRateFlag           = flag.Float64("max-rate", 0, "show at most this many updates per second and topic, 0 for no limit, can be overridden per topic in the config file")
+	dedupFlag             = flag.Bool("dedup", false, "ignore messages repeating the last payload of their topic, can be overridden per topic in the config file")
+	maxPayloadDisplayFlag = flag.Int("max-payload-display", 4096, "show only this many bytes of larger payloads other than JSON, 0 shows them in full")
+	maxDepthFlag          = flag.Int("max-depth", 0, "collapse the tree below this many levels, 0 shows all levels")
 )
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
+	if err := applyEnv(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadTags(); err != nil {
+		log.Fatal(err)
+	}
+	if *qosFlag < 0 || *qosFlag > 2 {
+		log.Fatalf("invalid -qos %d, must be 0, 1 or 2", *qosFlag)
+	}
+	if err := setTimestampFormat(*timestampFormatFlag); err != nil {
+		log.Fatal(err)
+	}
+	if *binaryFormatFlag != "hex" && *binaryFormatFlag != "base64" {
+		log.Fatalf("invalid -binary-format %q, must be hex or base64", *binaryFormatFlag)
+	}
+	if *statusIntervalFlag <= 0 {
+		log.Fatalf("invalid -status-interval %s, must be positive", *statusIntervalFlag)
+	}
+	if *delimiterFlag == "" {
+		log.Fatal("invalid -delimiter, must not be empty")
+	}
+	if *maxDepthFlag < 0 {
+		log.Fatalf("invalid -max-depth %d, must not be negative", *maxDepthFlag)
+	}
+	maxDepth = int32(*maxDepthFlag)
+	if err := startHistory(); err != nil {
+		log.Fatal(err)
+	}
 
-	var clientID string
-	if *clientIDFlag != "" {
-		clientID = *clientIDFlag
-	} else {
-		clientID = fmt.Sprintf("zapper-%s", randomClientID())
+	if *baselineFlag != "" {
+		b, err := loadBaseline(*baselineFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		baseline = b
+		showDiff = true
+	}
+	// Seed the tree before connecting so retained messages fill it in, but
+	// keep the seeded topics out of the headless modes' output.
+	if *topicsFileFlag != "" && !*snapshotFlag && !*dotFlag && *getFlag == "" && *forwardFlag == "" && !*statusLineFlag {
+		if err := seedTopics(*topicsFileFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cfg := configFromFlags()
+	if *listenFlag != "" {
+		if err := listen(*listenFlag); err != nil {
+			log.Fatal(err)
+		}
+		runWindow(cfg)
+		return
+	}
+
+	if *diagnoseFlag {
+		enablePahoLogs()
+		diagnose(cfg)
+	}
+	c, err := Connect(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	touchIdle(time.Now())
+	r := c.OptionsReader()
+	diag("MQTT connection established with %s", protocolName(r.ProtocolVersion()))
+	setClient(c, cfg)
+	setStatus("connected to %s", connectedBroker())
 
-	opts := mqtt.NewClientOptions().AddBroker(*brokerFlag).SetClientID(clientID)
-	opts.SetKeepAlive(2 * time.Second)
-	opts.SetPingTimeout(2 * time.Second)
-	opts.SetDefaultPublishHandler(defaultHandler)
-	opts.SetCleanSession(true)
+	if *forwardFlag != "" {
+		forward(*forwardFlag)
+		return
+	}
+
+	if *statusLineFlag {
+		printStatusLines()
+		return
+	}
+
+	if *snapshotFlag {
+		settle()
+		c.Disconnect(250)
+
+		mux.RLock()
+		defer mux.RUnlock()
+		if err := writeJSON(os.Stdout, &root); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *dotFlag {
+		settle()
+		c.Disconnect(250)
 
-	c := mqtt.NewClient(opts)
-	if t := c.Connect(); t.Wait() && t.Error() != nil {
-		log.Fatal(t.Error())
+		mux.RLock()
+		defer mux.RUnlock()
+		if err := writeDOT(os.Stdout, &root, *dotValuesFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	if t := c.Subscribe("#", 0, nil); t.Wait() && t.Error() != nil {
-		log.Fatal(t.Error())
+	if *getFlag != "" {
+		settle()
+		c.Disconnect(250)
+
+		mux.RLock()
+		defer mux.RUnlock()
+		n, err := writeValues(os.Stdout, &root)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n == 0 {
+			log.Fatalf("no messages on %s within %s", *getFlag, *settleFlag)
+		}
+		return
 	}
 
-	wnd := g.NewMasterWindow(clientID, 800, 800, 0)
+	runWindow(cfg)
+}
+
+// runWindow opens the main window and runs the UI until it is closed.
+func runWindow(cfg Config) {
+	// Redraw regularly so time based state such as the update filter and
+	// the reconnect countdown stays current while no messages arrive.
+	go func() {
+		for range time.Tick(time.Second) {
+			showHeld()
+			sampleStats()
+			checkIdle(time.Now())
+			refresh()
+		}
+	}()
+
+	windowTitle, shownTitle = cfg.ClientID, cfg.ClientID
+	brokerInput = cfg.Broker
+	publishQoS = int32(*qosFlag)
+	wnd = g.NewMasterWindow(cfg.ClientID, 800, 800, 0)
+	wnd.RegisterKeyboardShortcuts(g.WindowShortcut{
+		Key:      g.KeyP,
+		Modifier: g.ModControl,
+		Callback: togglePrefixSearch,
+	}, g.WindowShortcut{
+		Key:      g.KeyV,
+		Modifier: g.ModControl | g.ModShift,
+		Callback: copySelected,
+	})
 	wnd.Run(loop)
 }
 
+// configFromFlags returns the connection configuration given on the command
+// line.
+func configFromFlags() Config {
+	cfg := Config{
+		Broker:         defaultBroker,
+		ClientID:       *clientIDFlag,
+		Username:       *usernameFlag,
+		Password:       *passwordFlag,
+		Subscriptions:  topicFlags.filters(),
+		TLSServerName:  *tlsServerNameFlag,
+		PKCS12:         *pkcs12Flag,
+		PKCS12Password: *pkcs12PassFlag,
+		CertFile:       *certFileFlag,
+		KeyFile:        *keyFileFlag,
+		KeyPassword:    *keyPassFlag,
+		Proxy:          *proxyFlag,
+		ReconnectMin:   *reconnectMinFlag,
+		ReconnectMax:   *reconnectMaxFlag,
+	}
+	if len(brokerFlags) > 0 {
+		cfg.Broker, cfg.Fallbacks = brokerFlags[0], brokerFlags[1:]
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = generateClientID()
+	}
+	if *getFlag != "" {
+		cfg.Subscriptions = map[string]byte{*getFlag: byte(*qosFlag)}
+	} else if *uptimeFlag && !*snapshotFlag && !*dotFlag && !*statusLineFlag {
+		cfg.Subscriptions = withUptime(cfg.Subscriptions)
+	}
+	for _, p := range strings.Split(*tlsALPNFlag, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.TLSALPN = append(cfg.TLSALPN, p)
+		}
+	}
+	return cfg
+}
+
+// generateClientID returns a client ID of the form zapper-host-pid-random.
+// The host and process ID tell the broker's operators where the client runs,
+// the random part makes collisions practically impossible. Brokers limiting
+// client IDs to the 23 characters guaranteed by MQTT 3.1.1 need -client-id.
+func generateClientID() string {
+	parts := []string{"zapper"}
+	if h, err := os.Hostname(); err == nil {
+		if h = clientIDHost(h); h != "" {
+			parts = append(parts, h)
+		}
+	}
+	parts = append(parts, strconv.Itoa(os.Getpid()), randomClientID())
+	return strings.Join(parts, "-")
+}
+
+// clientIDHost shortens the host name h to its first label and drops all
+// characters other than letters, digits and hyphens.
+func clientIDHost(h string) string {
+	if i := strings.IndexByte(h, '.'); i >= 0 {
+		h = h[:i]
+	}
+	var b strings.Builder
+	for _, r := range h {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-') {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() > 16 {
+		return b.String()[:16]
+	}
+	return b.String()
+}
+
 func randomClientID() string {
-	b := make([]byte, 5)
+	b := make([]byte, 16)
 	_, err := rand.Read(b)
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a bit too long", 10, "a bit too…"},
+		{"äöüäöüäöüäöü", 4, "äöü…"},
+		{"unlimited", 0, "unlimited"},
+	}
+	for _, tt := range tests {
+		if got := preview(tt.s, tt.n); got != tt.want {
+			t.Errorf("preview(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestClientIDHost(t *testing.T) {
+	tests := []struct{ host, want string }{
+		{"laptop", "laptop"},
+		{"build-07.example.com", "build-07"},
+		{"Jürgens_PC", "JrgensPC"},
+		{"averyveryverylonghostname", "averyveryverylon"},
+	}
+	for _, tt := range tests {
+		if got := clientIDHost(tt.host); got != tt.want {
+			t.Errorf("clientIDHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "strings"
+
+// matchFilter reports whether topic matches the MQTT topic filter, which may
+// contain + and # wildcards. As required by the spec, wildcards at the
+// beginning of a filter don't match topics starting with $.
+func matchFilter(filter, topic string) bool {
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+
+	if len(fs) > 0 && (fs[0] == "+" || fs[0] == "#") && strings.HasPrefix(topic, "$") {
+		return false
+	}
+
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
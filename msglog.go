@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	g "github.com/AllenDang/giu"
+	"github.com/AllenDang/imgui-go"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var logSizeFlag = flag.Int("log-size", 1000, "number of messages kept for the message log panel, 0 disables it")
+
+// logHeight is the height of the message log panel.
+const logHeight = 200
+
+var (
+	// showLog shows the message log panel below the tree.
+	showLog bool
+	// logFilter hides log entries not containing it in their topic or value.
+	logFilter string
+	// logTopicFilter pins the log to the topics matching this MQTT topic
+	// filter, independent of the search of the tree.
+	logTopicFilter string
+
+	// messageLog holds the last -log-size messages, oldest first. It is
+	// protected by mux.
+	messageLog []logEntry
+)
+
+type logEntry struct {
+	at    time.Time
+	topic string
+	value string
+}
+
+// recordLog adds msg with its payload decoded as value to the message log.
+// The caller must hold mux.
+func recordLog(msg mqtt.Message, value string, now time.Time) {
+	if *logSizeFlag <= 0 {
+		return
+	}
+	messageLog = append(messageLog, logEntry{now, msg.Topic(), value})
+	if n := len(messageLog) - *logSizeFlag; n > 0 {
+		messageLog = messageLog[n:]
+	}
+}
+
+// filteredLog returns the log entries on topics matching the MQTT topic
+// filter topicFilter and containing filter, ignoring case. Empty filters
+// match all entries.
+func filteredLog(topicFilter, filter string) []logEntry {
+	if topicFilter == "" && filter == "" {
+		return messageLog
+	}
+	filter = strings.ToLower(filter)
+	var entries []logEntry
+	for _, e := range messageLog {
+		if topicFilter != "" && !matchFilter(topicFilter, e.topic) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(e.topic), filter) || strings.Contains(strings.ToLower(e.value), filter) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// pinLog shows the message log pinned to the topics matching filter.
+func pinLog(filter string) {
+	logTopicFilter = filter
+	showLog = true
+}
+
+// logPanelHeight returns the height taken by the message log panel.
+func logPanelHeight() float32 {
+	if !showLog {
+		return 0
+	}
+	return logHeight
+}
+
+// logView shows the message log, following new messages while scrolled to
+// the bottom. The caller must hold mux.
+func logView() g.Widget {
+	if !showLog {
+		return g.Layout{}
+	}
+
+	entries := filteredLog(logTopicFilter, logFilter)
+	rows := make([]g.Widget, 0, len(entries)+1)
+	for _, e := range entries {
+		rows = append(rows, g.Label(fmt.Sprintf("%s  %s  %s", e.at.Format("15:04:05.000"), e.topic, preview(e.value, *previewLenFlag))))
+	}
+	rows = append(rows, g.Custom(func() {
+		if imgui.ScrollY() >= imgui.ScrollMaxY() {
+			imgui.SetScrollHereY(1)
+		}
+	}))
+
+	return g.Layout{
+		g.Row(
+			g.Labelf("Message log, %d of %d messages", len(entries), len(messageLog)),
+			g.SmallButton("Clear log").OnClick(func() {
+				// logView runs with mux held for reading.
+				go func() {
+					mux.Lock()
+					messageLog = nil
+					mux.Unlock()
+					refresh()
+				}()
+			}),
+			g.InputText(&logTopicFilter).Hint("topic filter, e.g. devices/42/#").Size(250),
+			g.InputText(&logFilter).Hint("filter").Size(g.Auto),
+		),
+		g.Child().Size(g.Auto, logHeight-30).Layout(rows...),
+	}
+}
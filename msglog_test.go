@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessageLogIsCapped(t *testing.T) {
+	defer func(n int) { *logSizeFlag = n }(*logSizeFlag)
+	*logSizeFlag = 3
+	mux.Lock()
+	defer mux.Unlock()
+	messageLog = nil
+	defer func() { messageLog = nil }()
+
+	now := time.Now()
+	for _, topic := range []string{"a", "b", "c", "d"} {
+		recordLog(&forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("on")}}, `"on"`, now)
+	}
+	if len(messageLog) != 3 || messageLog[0].topic != "b" || messageLog[2].topic != "d" {
+		t.Fatalf("messageLog = %+v, want b to d", messageLog)
+	}
+
+	recordLog(&forwardedMessage{exportedTopic{Topic: "sensors/Temp", Payload: []byte("21")}}, "21", now)
+	if got := filteredLog("", "temp"); len(got) != 1 || got[0].topic != "sensors/Temp" {
+		t.Errorf("filteredLog(temp) = %+v", got)
+	}
+	if got := filteredLog("", "ON"); len(got) != 2 {
+		t.Errorf("filteredLog(ON) = %+v, want 2 entries", got)
+	}
+	if got := filteredLog("sensors/#", ""); len(got) != 1 || got[0].topic != "sensors/Temp" {
+		t.Errorf("filteredLog(sensors/#) = %+v", got)
+	}
+	if got := filteredLog("+", "on"); len(got) != 2 {
+		t.Errorf("filteredLog(+, on) = %+v, want 2 entries", got)
+	}
+}
+
+func TestMessageLogValues(t *testing.T) {
+	resetTree(t)
+	mux.Lock()
+	messageLog = nil
+	mux.Unlock()
+	defer func() { messageLog = nil }()
+
+	for _, m := range []exportedTopic{
+		{Topic: "a/temp", Payload: []byte("21.5")},
+		{Topic: "a/state", Payload: []byte("on")},
+		{Topic: "a/temp", Payload: nil},
+	} {
+		defaultHandler(nil, &forwardedMessage{m})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	want := []string{"21.5", `"on"`, emptyPayload}
+	if len(messageLog) != len(want) {
+		t.Fatalf("messageLog = %+v, want %d entries", messageLog, len(want))
+	}
+	for i, e := range messageLog {
+		if e.value != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, e.value, want[i])
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"golang.org/x/net/proxy"
+)
+
+var proxyFlag = flag.String("proxy", "", "connect through a proxy (socks5://[user:pass@]host:port or http://[user:pass@]host:port)")
+
+// parseProxy parses and validates a proxy URL given with -proxy.
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: scheme must be socks5, socks5h or http", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", raw)
+	}
+	if u.Port() == "" && u.Scheme != "http" {
+		u.Host = net.JoinHostPort(u.Hostname(), "1080")
+	}
+	return u, nil
+}
+
+// setProxy makes opts connect through the proxy at u.
+func setProxy(opts *mqtt.ClientOptions, u *url.URL, broker string) error {
+	b, err := url.Parse(broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker %q: %w", broker, err)
+	}
+
+	switch b.Scheme {
+	case "ws", "wss":
+		// The websocket dialer supports proxies on its own.
+		opts.SetWebsocketOptions(&mqtt.WebsocketOptions{Proxy: http.ProxyURL(u)})
+		return nil
+	case "mqtt", "tcp", "ssl", "tls", "mqtts", "mqtt+ssl", "tcps":
+	default:
+		return fmt.Errorf("proxies are not supported for %s brokers", b.Scheme)
+	}
+
+	d, err := proxyDialer(u)
+	if err != nil {
+		return err
+	}
+
+	opts.SetCustomOpenConnectionFn(func(uri *url.URL, o mqtt.ClientOptions) (net.Conn, error) {
+		conn, err := d.Dial("tcp", uri.Host)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %s: %w", u.Redacted(), err)
+		}
+		secure, _ := isTLSScheme(uri.String())
+		if !secure {
+			return conn, nil
+		}
+
+		cfg := o.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = uri.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	})
+	return nil
+}
+
+// proxyDialer returns a dialer connecting through the proxy at u.
+func proxyDialer(u *url.URL) (proxy.Dialer, error) {
+	if u.Scheme == "http" {
+		return &httpProxyDialer{proxy: u}, nil
+	}
+	return proxy.FromURL(u, proxy.Direct)
+}
+
+// httpProxyDialer tunnels connections through an HTTP proxy using CONNECT.
+type httpProxyDialer struct {
+	proxy *url.URL
+}
+
+func (d *httpProxyDialer) Dial(network, addr string) (net.Conn, error) {
+	host := d.proxy.Host
+	if d.proxy.Port() == "" {
+		host = net.JoinHostPort(d.proxy.Hostname(), "80")
+	}
+	conn, err := net.Dial(network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := d.proxy.User; u != nil {
+		p, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + p))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn that first returns the data already read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
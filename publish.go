@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+var (
+	// quickSendLine is the line typed or pasted into the quick send field.
+	quickSendLine string
+
+	// publishQoS and publishRetain are the QoS and retain flag of messages
+	// published from the GUI, the QoS defaults to -qos. The r: prefix of
+	// quick send lines retains regardless.
+	publishQoS    int32
+	publishRetain bool
+
+	// publishFileTopic and publishFilePath are the topic and the file with
+	// the payload of messages published from a file.
+	publishFileTopic string
+	publishFilePath  string
+)
+
+// parseQuickSend splits a quick send line of the form [r:]topic payload or
+// [r:]topic=payload into its parts. The r: prefix publishes a retained
+// message, a line without payload publishes an empty one.
+func parseQuickSend(line string) (topic, payload string, retain bool, err error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "r:") {
+		line, retain = line[len("r:"):], true
+	}
+	topic = line
+	if i := strings.IndexAny(line, " ="); i >= 0 {
+		topic, payload = line[:i], line[i+1:]
+	}
+	if topic == "" {
+		return "", "", false, errors.New("missing topic")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return "", "", false, fmt.Errorf("can't publish to the topic filter %s", topic)
+	}
+	return topic, payload, retain, nil
+}
+
+// quickSend publishes the message described by line, see parseQuickSend,
+// and tells the outcome in the status.
+func quickSend(line string) {
+	topic, payload, retain, err := parseQuickSend(line)
+	if err != nil {
+		setStatus("not published: %v", err)
+		return
+	}
+	publish(topic, []byte(payload), byte(publishQoS), retain || publishRetain)
+}
+
+// publishFile publishes the contents of the file name as they are.
+func publishFile(topic, name string, qos byte, retain bool) {
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		setStatus("not published: invalid topic %q", topic)
+		return
+	}
+	payload, err := os.ReadFile(name)
+	if err != nil {
+		setStatus("not published: %v", err)
+		return
+	}
+	publish(topic, payload, qos, retain)
+}
+
+// publish publishes payload through the current client and tells the
+// outcome in the status.
+func publish(topic string, payload []byte, qos byte, retain bool) {
+	c, _ := currentClient()
+	if c == nil {
+		return
+	}
+	if t := c.Publish(topic, qos, retain, payload); t.Wait() && t.Error() != nil {
+		setStatus("publishing to %s failed: %v", topic, t.Error())
+		return
+	}
+	if retain {
+		setStatus("published retained message of %d bytes to %s", len(payload), topic)
+	} else {
+		setStatus("published %d bytes to %s", len(payload), topic)
+	}
+}
+
+// quickSendField returns the fields to publish a message by entering a line
+// or from a file, or nothing if zapper doesn't connect to a broker.
+func quickSendField() g.Widget {
+	if c, _ := currentClient(); c == nil {
+		return g.Layout{}
+	}
+	send := func() {
+		line := quickSendLine
+		quickSendLine = ""
+		go quickSend(line)
+	}
+	sendFile := func() {
+		go publishFile(publishFileTopic, publishFilePath, byte(publishQoS), publishRetain)
+	}
+	return g.Layout{
+		g.Row(
+			g.Label("QoS"),
+			g.InputInt(&publishQoS).Size(80).OnChange(func() {
+				if publishQoS < 0 {
+					publishQoS = 0
+				} else if publishQoS > 2 {
+					publishQoS = 2
+				}
+			}),
+			g.Checkbox("Retain", &publishRetain),
+			g.Label("Publish file"),
+			g.InputText(&publishFileTopic).Hint("topic").Size(200),
+			g.InputText(&publishFilePath).Hint("path of the payload file").Size(250),
+			g.SmallButton("Publish file").OnClick(sendFile),
+		),
+		g.Row(
+			g.Label("Publish"),
+			g.InputText(&quickSendLine).Hint("[r:]topic payload or [r:]topic=payload, Enter sends").Size(g.Auto).
+				Flags(g.InputTextFlagsEnterReturnsTrue).OnChange(send),
+		),
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseQuickSend(t *testing.T) {
+	for _, tt := range []struct {
+		line, topic, payload string
+		retain, err          bool
+	}{
+		{line: "home/light on", topic: "home/light", payload: "on"},
+		{line: "home/light=on", topic: "home/light", payload: "on"},
+		{line: "  r:home/light {\"on\": true}  ", topic: "home/light", payload: "{\"on\": true}", retain: true},
+		{line: "home/light a=b", topic: "home/light", payload: "a=b"},
+		{line: "r:home/light", topic: "home/light", retain: true},
+		{line: "r:", err: true},
+		{line: "home/+ on", err: true},
+	} {
+		topic, payload, retain, err := parseQuickSend(tt.line)
+		if (err != nil) != tt.err {
+			t.Errorf("parseQuickSend(%q) error = %v, want error %v", tt.line, err, tt.err)
+			continue
+		}
+		if topic != tt.topic || payload != tt.payload || retain != tt.retain {
+			t.Errorf("parseQuickSend(%q) = %q, %q, %v, want %q, %q, %v", tt.line, topic, payload, retain, tt.topic, tt.payload, tt.retain)
+		}
+	}
+}
+
+func TestQuickSend(t *testing.T) {
+	resetTree(t)
+	c, err := Connect(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClient(c, testConfig())
+	defer func() {
+		c.Disconnect(0)
+		setClient(nil, Config{})
+	}()
+
+	quickSend("r:quick/sent=42")
+	if got := waitFor(t, "quick/sent"); got != "42" {
+		t.Errorf("quick/sent = %q, want 42", got)
+	}
+	broker.mu.Lock()
+	retained := string(broker.retained["quick/sent"])
+	broker.mu.Unlock()
+	if retained != "42" {
+		t.Errorf("retained payload = %q, want 42", retained)
+	}
+}
+
+func TestPublishFile(t *testing.T) {
+	resetTree(t)
+	c, err := Connect(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClient(c, testConfig())
+	defer func() {
+		c.Disconnect(0)
+		setClient(nil, Config{})
+	}()
+
+	name := filepath.Join(t.TempDir(), "payload.bin")
+	payload := []byte{0x00, 0xff, 0x10, 0x80}
+	if err := os.WriteFile(name, payload, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	publishFile("file/sent", name, 1, true)
+	waitFor(t, "file/sent")
+
+	mux.RLock()
+	got := lookupLocked("file/sent").last.Payload()
+	mux.RUnlock()
+	if !bytes.Equal(got, payload) {
+		t.Errorf("payload = %x, want %x", got, payload)
+	}
+	broker.mu.Lock()
+	retained := broker.retained["file/sent"]
+	broker.mu.Unlock()
+	if !bytes.Equal(retained, payload) {
+		t.Errorf("retained payload = %x, want %x", retained, payload)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var recentValuesFlag = flag.Int("recent-values", 20, "number of recent values kept per topic for copying them as CSV")
+
+// timedValue is a value of a topic as shown in the tree and when it arrived.
+type timedValue struct {
+	at    time.Time
+	value string
+}
+
+// remember adds value to the recent values of t, dropping the oldest one
+// beyond -recent-values.
+func (t *topic) remember(at time.Time, value string) {
+	if *recentValuesFlag <= 0 {
+		return
+	}
+	t.recent = append(t.recent, timedValue{at, value})
+	if n := len(t.recent) - *recentValuesFlag; n > 0 {
+		t.recent = t.recent[n:]
+	}
+}
+
+// recentCSV returns the recent values of t as CSV with a header, oldest
+// first.
+func (t *topic) recentCSV() string {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write([]string{"time", "value"})
+	for _, v := range t.recent {
+		_ = w.Write([]string{v.at.Format(time.RFC3339Nano), v.value})
+	}
+	w.Flush()
+	return b.String()
+}
+
+// copyRecent copies the recent values of t to the clipboard.
+func copyRecent(t *topic) {
+	mux.RLock()
+	s := t.recentCSV()
+	mux.RUnlock()
+	g.Context.GetPlatform().SetClipboard(s)
+}
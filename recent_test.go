@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecentValues(t *testing.T) {
+	defer func(n int) { *recentValuesFlag = n }(*recentValuesFlag)
+	*recentValuesFlag = 2
+
+	n := &topic{}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	n.remember(at, "1")
+	n.remember(at.Add(time.Second), `"a, b"`)
+	n.remember(at.Add(2*time.Second), "3")
+
+	want := "time,value\n" +
+		"2024-05-01T12:00:01Z,\"\"\"a, b\"\"\"\n" +
+		"2024-05-01T12:00:02Z,3\n"
+	if got := n.recentCSV(); got != want {
+		t.Errorf("recentCSV() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+// session describes the connection for a report.
+type session struct {
+	Broker      string
+	ClientID    string
+	ConnectedAt time.Time
+}
+
+// writeReport writes a human readable report of the session and all topics
+// below t with their values and when they were last seen to w, for pasting
+// into bug reports. The caller must hold mux.
+func writeReport(w io.Writer, s session, t *topic, now time.Time) error {
+	leaves := sortedLeaves(t)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "zapper session report")
+	fmt.Fprintln(bw)
+	tw := tabwriter.NewWriter(bw, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(tw, "Broker:\t%s\n", s.Broker)
+	fmt.Fprintf(tw, "Client ID:\t%s\n", s.ClientID)
+	if !s.ConnectedAt.IsZero() {
+		fmt.Fprintf(tw, "Connected:\t%s (%s ago)\n", s.ConnectedAt.Format(time.RFC3339), now.Sub(s.ConnectedAt).Round(time.Second))
+	}
+	fmt.Fprintf(tw, "Generated:\t%s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Topics:\t%d\n", len(leaves))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(bw)
+	tw = tabwriter.NewWriter(bw, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tVALUE\tLAST SEEN\tRETAINED")
+	for _, c := range leaves {
+		// Tabs and line breaks in values would break the columns.
+		value := strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(c.value())
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\n", c.last.Topic(), value, c.lastSeen.Format(time.RFC3339), c.last.Retained())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// copyReport copies the report of the session to the clipboard.
+func copyReport() {
+	_, cfg := currentClient()
+	s := session{Broker: connectedBroker(), ClientID: cfg.ClientID, ConnectedAt: connectedSince()}
+	var b strings.Builder
+	mux.RLock()
+	_ = writeReport(&b, s, &root, time.Now())
+	mux.RUnlock()
+	g.Context.GetPlatform().SetClipboard(b.String())
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var rootFlag = flag.String("root", "", "show only topics below this prefix, e.g. factory/line1/, starting the tree there; copied topics stay complete")
+
+// rootPrefix returns the prefix given with -root, ending in -delimiter.
+func rootPrefix() string {
+	p := *rootFlag
+	if p != "" && !strings.HasSuffix(p, *delimiterFlag) {
+		p += *delimiterFlag
+	}
+	return p
+}
+
+// belowRoot returns topic relative to -root, or false if it is not below it.
+func belowRoot(topic string) (string, bool) {
+	p := rootPrefix()
+	if !strings.HasPrefix(topic, p) || len(topic) == len(p) && p != "" {
+		return "", false
+	}
+	return topic[len(p):], true
+}
+
+// topicPath returns the complete topic path of t, including -root, as
+// opposed to path, which is relative to the top of the tree.
+func (t *topic) topicPath() string {
+	return rootPrefix() + t.path()
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestRoot(t *testing.T) {
+	resetTree(t)
+	defer func(v string) { *rootFlag = v }(*rootFlag)
+	*rootFlag = "factory/line1"
+
+	for _, m := range []exportedTopic{
+		{Topic: "factory/line1/press/temp", Payload: []byte("80")},
+		{Topic: "factory/line2/press/temp", Payload: []byte("75")},
+		{Topic: "factory/line1", Payload: []byte("on")},
+	} {
+		defaultHandler(nil, &forwardedMessage{m})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	if len(root.children) != 1 {
+		t.Errorf("top of the tree has %d children, want only press", len(root.children))
+	}
+	press := lookupLocked("press")
+	if press == nil {
+		t.Fatal("press not in the tree")
+	}
+	if got, want := press.subscriptionFilter(), "factory/line1/press/#"; got != want {
+		t.Errorf("subscriptionFilter() = %s, want %s", got, want)
+	}
+	if got := root.find("factory/line1/press/temp"); got != lookupLocked("press/temp") {
+		t.Errorf("find() = %v, want press/temp", got)
+	}
+}
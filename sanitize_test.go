@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeUTF16(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"LE with BOM", []byte{0xff, 0xfe, 'H', 0, 'i', 0, ' ', 0, 0xac, 0x20}, `"Hi €"`},
+		{"BE with BOM", []byte{0xfe, 0xff, 0, 'H', 0, 'i'}, `"Hi"`},
+		{"odd length", []byte{0xff, 0xfe, 'H'}, "0xfffe48"},
+	}
+	for _, tt := range tests {
+		if got := sanitize(tt.payload); got != tt.want {
+			t.Errorf("%s: sanitize(%x) = %s, want %s", tt.name, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeEncoding(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    encoding
+	}{
+		{[]byte(`{"a":1}`), encodingJSON},
+		{[]byte(`[1,2,3]`), encodingJSON},
+		{[]byte(` [{"a":1}] `), encodingJSON},
+		{[]byte(`[1,2`), encodingText},
+		{[]byte("on"), encodingText},
+		{[]byte("true"), encodingBool},
+		{[]byte("-1.5"), encodingNumber},
+		{[]byte{0xff, 0xfe, 'H', 0}, encodingText},
+		{[]byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}, encodingBinary},
+		{[]byte{0xff}, encodingBinary},
+	}
+	for _, tt := range tests {
+		if _, got := decode(tt.payload); got != tt.want {
+			t.Errorf("decode(%x) encoding = %s, want %s", tt.payload, encodingNames[got], encodingNames[tt.want])
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    string
+	}{
+		{[]byte(`{"a": "b"}`), `{"a": "b"}`},
+		{[]byte("42"), "42"},
+		{[]byte("a\tb\nc"), "a\tb\nc"},
+		{[]byte("ä\x00\xff"), `ä\x00\xff`},
+	}
+	for _, tt := range tests {
+		if got := raw(tt.payload); got != tt.want {
+			t.Errorf("raw(%q) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeSpecialFloats(t *testing.T) {
+	nan := []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x7f}
+	posInf := []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x7f}
+	negInf := []byte{0, 0, 0, 0, 0, 0, 0xf0, 0xff}
+
+	// Without -float-special, the first four bytes are shown as an integer.
+	for _, p := range [][]byte{nan, posInf, negInf} {
+		if got := sanitize(p); got != "0" {
+			t.Errorf("sanitize(%x) = %s, want 0", p, got)
+		}
+	}
+
+	*floatSpecialFlag = true
+	defer func() { *floatSpecialFlag = false }()
+	tests := []struct {
+		payload []byte
+		want    string
+	}{
+		{nan, "NaN"},
+		{[]byte{1, 0, 0, 0, 0, 0, 0xf0, 0x7f}, "NaN"},
+		{posInf, "+Inf"},
+		{negInf, "-Inf"},
+	}
+	for _, tt := range tests {
+		if got := sanitize(tt.payload); got != tt.want {
+			t.Errorf("sanitize(%x) = %s, want %s", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeJSON(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+		enc     encoding
+	}{
+		{`{"a": 1}`, `{"a": 1}`, encodingJSON},
+		{"[1,2,3]", "[1,2,3]", encodingJSON},
+		{"42", "42", encodingNumber},
+		{"-1.5e3\n", "-1.5e3", encodingNumber},
+		{`"quoted"`, `"quoted"`, encodingJSON},
+		{"null", "null", encodingJSON},
+		{"true", "true", encodingBool},
+		{" false ", "false", encodingBool},
+		{"NaN", "NaN", encodingNumber},
+		{"quoted", `"quoted"`, encodingText},
+	}
+	for _, tt := range tests {
+		got, enc := decode([]byte(tt.payload))
+		if got != tt.want || enc != tt.enc {
+			t.Errorf("decode(%q) = %s, %s, want %s, %s", tt.payload, got, encodingNames[enc], tt.want, encodingNames[tt.enc])
+		}
+	}
+}
+
+func TestBinaryFormat(t *testing.T) {
+	defer func(v string) { *binaryFormatFlag = v }(*binaryFormatFlag)
+	payload := []byte{0xde, 0xad, 0xbe}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"hex", "0xdeadbe"},
+		{"base64", "3q2+"},
+	}
+	for _, tt := range tests {
+		*binaryFormatFlag = tt.format
+		if got := sanitize(payload); got != tt.want {
+			t.Errorf("-binary-format %s: sanitize(%x) = %s, want %s", tt.format, payload, got, tt.want)
+		}
+	}
+}
+
+// TestSanitizeBranches covers each way sanitize decodes payloads, including
+// text mistaken for binary numbers.
+func TestSanitizeBranches(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"JSON object", []byte(`{"a": [1, 2]}`), `{"a": [1, 2]}`},
+		{"JSON array", []byte(`[1,2]`), `[1,2]`},
+		{"true", []byte("true"), "true"},
+		{"false", []byte("false"), "false"},
+		{"number", []byte("21.5"), "21.5"},
+		{"number outside JSON", []byte("NaN"), "NaN"},
+		{"text", []byte("hello world"), `"hello world"`},
+		{"4 bytes of text", []byte("abcd"), `"abcd"`},
+		{"8 bytes of text", []byte("abcdefgh"), `"abcdefgh"`},
+		{"empty", []byte{}, "<empty>"},
+		{"binary float", []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}, "1.000000"},
+		{"binary NaN as int", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "-1"},
+		{"binary int", []byte{1, 0, 0, 0}, "1"},
+		{"4 bytes of text with line break as int", []byte("ok\r\n"), "168651631"},
+		{"8 bytes of text with line break as float", []byte("ab\ncdef@"), "179.168504"},
+		{"hex", []byte{1, 2, 3}, "0x010203"},
+		{"invalid UTF-8", []byte{0xc3, 0x28}, "0xc328"},
+	}
+	for _, tt := range tests {
+		if got := sanitize(tt.payload); got != tt.want {
+			t.Errorf("%s: sanitize(%q) = %s, want %s", tt.name, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeEmpty(t *testing.T) {
+	for _, payload := range [][]byte{nil, {}} {
+		if got, enc := decode(payload); got != emptyPayload || enc != encodingText {
+			t.Errorf("decode(%#v) = %s, %s, want %s, text", payload, got, encodingNames[enc], emptyPayload)
+		}
+	}
+}
+
+func TestDecodeLargePayloads(t *testing.T) {
+	defer func(n int) { *maxPayloadDisplayFlag = n }(*maxPayloadDisplayFlag)
+	*maxPayloadDisplayFlag = 16
+
+	doc := `{"values": [` + strings.Repeat("1, ", 20) + `1]}`
+	if got, enc := decode([]byte(doc)); got != doc || enc != encodingJSON {
+		t.Errorf("decode(%d bytes of JSON) = %q, %v, want the document as JSON", len(doc), got, enc)
+	}
+	text := strings.Repeat("a", 40)
+	want := `"` + strings.Repeat("a", 16) + `" (40 bytes, truncated)`
+	if got, enc := decode([]byte(text)); got != want || enc != encodingText {
+		t.Errorf("decode(40 bytes of text) = %q, %v, want %q as text", got, enc, want)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is a compiled JSON Schema. The validation keywords of draft 7
+// that don't need references or formats are supported. Schemas using other
+// keywords, other than annotations, don't compile rather than accepting
+// values they should reject.
+type jsonSchema struct {
+	// never is set for the schema false, which no value is valid against.
+	never bool
+
+	types    []string
+	enum     []interface{}
+	constVal interface{}
+	hasConst bool
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+
+	items              *jsonSchema
+	minItems, maxItems *int
+
+	allOf, anyOf, oneOf []*jsonSchema
+	not                 *jsonSchema
+}
+
+// compileSchema compiles the JSON Schema document b.
+func compileSchema(b []byte) (*jsonSchema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return compileSchemaValue(doc, "#")
+}
+
+func compileSchemaValue(doc interface{}, at string) (*jsonSchema, error) {
+	switch doc := doc.(type) {
+	case bool:
+		return &jsonSchema{never: !doc}, nil
+	case map[string]interface{}:
+		s := &jsonSchema{}
+		for k, v := range doc {
+			if err := s.compileKeyword(k, v, at+"/"+k); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", at)
+	}
+}
+
+func (s *jsonSchema) compileKeyword(k string, v interface{}, at string) error {
+	var err error
+	switch k {
+	case "type":
+		switch v := v.(type) {
+		case string:
+			s.types = []string{v}
+		case []interface{}:
+			for _, t := range v {
+				name, ok := t.(string)
+				if !ok {
+					return fmt.Errorf("%s: must be a string or an array of strings", at)
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return fmt.Errorf("%s: must be a string or an array of strings", at)
+		}
+	case "enum":
+		var ok bool
+		if s.enum, ok = v.([]interface{}); !ok {
+			return fmt.Errorf("%s: must be an array", at)
+		}
+	case "const":
+		s.constVal, s.hasConst = v, true
+	case "minimum":
+		s.minimum, err = schemaNumber(v, at)
+	case "maximum":
+		s.maximum, err = schemaNumber(v, at)
+	case "exclusiveMinimum":
+		s.exclusiveMinimum, err = schemaNumber(v, at)
+	case "exclusiveMaximum":
+		s.exclusiveMaximum, err = schemaNumber(v, at)
+	case "multipleOf":
+		s.multipleOf, err = schemaNumber(v, at)
+	case "minLength":
+		s.minLength, err = schemaInt(v, at)
+	case "maxLength":
+		s.maxLength, err = schemaInt(v, at)
+	case "minItems":
+		s.minItems, err = schemaInt(v, at)
+	case "maxItems":
+		s.maxItems, err = schemaInt(v, at)
+	case "pattern":
+		p, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", at)
+		}
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+	case "required":
+		names, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an array", at)
+		}
+		for _, n := range names {
+			name, ok := n.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be an array of strings", at)
+			}
+			s.required = append(s.required, name)
+		}
+	case "properties":
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an object", at)
+		}
+		s.properties = make(map[string]*jsonSchema, len(props))
+		for name, p := range props {
+			if s.properties[name], err = compileSchemaValue(p, at+"/"+name); err != nil {
+				return err
+			}
+		}
+	case "additionalProperties":
+		s.additionalProperties, err = compileSchemaValue(v, at)
+	case "items":
+		s.items, err = compileSchemaValue(v, at)
+	case "not":
+		s.not, err = compileSchemaValue(v, at)
+	case "allOf":
+		s.allOf, err = compileSchemaList(v, at)
+	case "anyOf":
+		s.anyOf, err = compileSchemaList(v, at)
+	case "oneOf":
+		s.oneOf, err = compileSchemaList(v, at)
+	case "$schema", "$id", "$comment", "title", "description", "default", "examples":
+		// Annotations don't affect validation.
+	default:
+		return fmt.Errorf("%s: unsupported keyword", at)
+	}
+	return err
+}
+
+func compileSchemaList(v interface{}, at string) ([]*jsonSchema, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array", at)
+	}
+	schemas := make([]*jsonSchema, len(list))
+	for i, e := range list {
+		var err error
+		if schemas[i], err = compileSchemaValue(e, fmt.Sprintf("%s/%d", at, i)); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+func schemaNumber(v interface{}, at string) (*float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", at)
+	}
+	return &f, nil
+}
+
+func schemaInt(v interface{}, at string) (*int, error) {
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) || f < 0 {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", at)
+	}
+	i := int(f)
+	return &i, nil
+}
+
+// validatePayload validates the JSON document in payload against s.
+func (s *jsonSchema) validatePayload(payload []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return fmt.Errorf("not JSON: %v", err)
+	}
+	return s.validate(v, "$")
+}
+
+// validate validates the decoded JSON value v found at path against s.
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if s.never {
+		return fmt.Errorf("%s: not allowed", path)
+	}
+
+	if len(s.types) > 0 {
+		ok := false
+		for _, t := range s.types {
+			if jsonType(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: expected %s", path, strings.Join(s.types, " or "))
+		}
+	}
+	if s.enum != nil {
+		ok := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: not one of the allowed values", path)
+		}
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constVal, v) {
+		return fmt.Errorf("%s: not the expected constant", path)
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if err := s.validateNumber(v, path); err != nil {
+			return err
+		}
+	case string:
+		if err := s.validateString(v, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := s.validateArray(v, path); err != nil {
+			return err
+		}
+	case map[string]interface{}:
+		if err := s.validateObject(v, path); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil {
+		var firstErr error
+		for _, sub := range s.anyOf {
+			if err := sub.validate(v, path); err == nil {
+				firstErr = nil
+				break
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return fmt.Errorf("%s: matches none of anyOf (%v)", path, firstErr)
+		}
+	}
+	if s.oneOf != nil {
+		n := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, path) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("%s: matches %d instead of one of oneOf", path, n)
+		}
+	}
+	if s.not != nil && s.not.validate(v, path) == nil {
+		return fmt.Errorf("%s: must not match schema", path)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateNumber(v float64, path string) error {
+	switch {
+	case s.minimum != nil && v < *s.minimum:
+		return fmt.Errorf("%s: %v is less than %v", path, v, *s.minimum)
+	case s.maximum != nil && v > *s.maximum:
+		return fmt.Errorf("%s: %v is greater than %v", path, v, *s.maximum)
+	case s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum:
+		return fmt.Errorf("%s: %v is not greater than %v", path, v, *s.exclusiveMinimum)
+	case s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum:
+		return fmt.Errorf("%s: %v is not less than %v", path, v, *s.exclusiveMaximum)
+	case s.multipleOf != nil && *s.multipleOf != 0 && math.Mod(v, *s.multipleOf) != 0:
+		return fmt.Errorf("%s: %v is not a multiple of %v", path, v, *s.multipleOf)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateString(v string, path string) error {
+	n := len([]rune(v))
+	switch {
+	case s.minLength != nil && n < *s.minLength:
+		return fmt.Errorf("%s: shorter than %d characters", path, *s.minLength)
+	case s.maxLength != nil && n > *s.maxLength:
+		return fmt.Errorf("%s: longer than %d characters", path, *s.maxLength)
+	case s.pattern != nil && !s.pattern.MatchString(v):
+		return fmt.Errorf("%s: does not match %s", path, s.pattern)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateArray(v []interface{}, path string) error {
+	switch {
+	case s.minItems != nil && len(v) < *s.minItems:
+		return fmt.Errorf("%s: fewer than %d items", path, *s.minItems)
+	case s.maxItems != nil && len(v) > *s.maxItems:
+		return fmt.Errorf("%s: more than %d items", path, *s.maxItems)
+	}
+	if s.items != nil {
+		for i, e := range v {
+			if err := s.items.validate(e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateObject(v map[string]interface{}, path string) error {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			return fmt.Errorf("%s: missing required field %s", path, name)
+		}
+	}
+
+	// Validate in a stable order to always report the same error.
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sub, ok := s.properties[name]
+		if !ok {
+			sub = s.additionalProperties
+		}
+		if sub == nil {
+			continue
+		}
+		if err := sub.validate(v[name], path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonType reports whether the decoded JSON value v is of the JSON Schema
+// type t.
+func jsonType(v interface{}, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case float64:
+		return t == "number" || t == "integer" && v == math.Trunc(v)
+	case string:
+		return t == "string"
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := compileSchema([]byte(`{
+		"type": "object",
+		"required": ["temperature"],
+		"properties": {
+			"temperature": {"type": "number", "minimum": -40, "maximum": 85},
+			"unit": {"enum": ["C", "F"]},
+			"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"count": {"type": "integer"}
+		},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		payload string
+		valid   bool
+	}{
+		{`{"temperature": 21.5}`, true},
+		{`{"temperature": 21.5, "unit": "C", "name": "kitchen", "tags": ["a"], "count": 3}`, true},
+		{`{}`, false},
+		{`[]`, false},
+		{`{"temperature": "warm"}`, false},
+		{`{"temperature": 100}`, false},
+		{`{"temperature": 1, "unit": "K"}`, false},
+		{`{"temperature": 1, "name": "Kitchen"}`, false},
+		{`{"temperature": 1, "name": "livingroom"}`, false},
+		{`{"temperature": 1, "tags": ["a", 1]}`, false},
+		{`{"temperature": 1, "tags": ["a", "b", "c"]}`, false},
+		{`{"temperature": 1, "count": 1.5}`, false},
+		{`{"temperature": 1, "extra": true}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		err := s.validatePayload([]byte(tt.payload))
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.payload, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: expected error", tt.payload)
+		}
+	}
+}
+
+func TestSchemaCombinators(t *testing.T) {
+	s, err := compileSchema([]byte(`{
+		"anyOf": [{"type": "string"}, {"type": "number", "exclusiveMinimum": 0}],
+		"not": {"const": "off"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for payload, valid := range map[string]bool{
+		`"on"`:  true,
+		`"off"`: false,
+		`1`:     true,
+		`0`:     false,
+		`true`:  false,
+	} {
+		if err := s.validatePayload([]byte(payload)); (err == nil) != valid {
+			t.Errorf("%s: valid = %t, want %t (%v)", payload, err == nil, valid, err)
+		}
+	}
+}
+
+func TestSchemaAnnotations(t *testing.T) {
+	doc := `{"$schema": "http://json-schema.org/draft-07/schema#", "$id": "temp", "title": "Temperature", "description": "in °C", "type": "number"}`
+	if _, err := compileSchema([]byte(doc)); err != nil {
+		t.Errorf("compileSchema() = %v, want annotations ignored", err)
+	}
+}
+
+func TestSchemaCompileErrors(t *testing.T) {
+	for _, doc := range []string{`1`, `{"type": 1}`, `{"minLength": -1}`, `{"pattern": "("}`, `{"properties": {"a": 1}}`,
+		`{"$ref": "#/definitions/a"}`, `{"format": "date-time"}`, `{"properties": {"a": {"uniqueItems": true}}}`} {
+		if _, err := compileSchema([]byte(doc)); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+	}
+}
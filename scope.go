@@ -0,0 +1,61 @@
+package main
+
+import g "github.com/AllenDang/giu"
+
+// searchScope limits the search to the topics below it. Nil searches the
+// whole tree. It is protected by mux.
+var searchScope *topic
+
+// searchRoot returns the topic whose descendants are searched. Scopes that
+// were removed from the tree fall back to the whole tree. The caller must
+// hold mux.
+func searchRoot() *topic {
+	for n := searchScope; n != nil && n.parent != nil; n = n.parent {
+		if n.parent.children[n.name] != n {
+			return &root
+		}
+	}
+	if searchScope == nil {
+		return &root
+	}
+	return searchScope
+}
+
+// inSearchScope reports whether t is below the search scope. The caller must
+// hold mux.
+func inSearchScope(t *topic) bool {
+	s := searchRoot()
+	if s == &root {
+		return true
+	}
+	for n := t.parent; n != nil; n = n.parent {
+		if n == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setSearchScope limits the search to the topics below t, or the whole tree
+// if t is nil.
+func setSearchScope(t *topic) {
+	mux.Lock()
+	searchScope = t
+	mux.Unlock()
+	refresh()
+}
+
+// scopeSelector returns the search scope with a button to search the whole
+// tree again, or nothing if the whole tree is searched.
+func scopeSelector() g.Widget {
+	mux.RLock()
+	defer mux.RUnlock()
+	s := searchRoot()
+	if s == &root {
+		return g.Layout{}
+	}
+	return g.Layout{
+		g.Label("in " + s.path()),
+		g.SmallButton("Whole tree").OnClick(func() { setSearchScope(nil) }),
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import "testing"
+
+func TestPrefixRelevance(t *testing.T) {
+	resetTree(t)
+	connectTest(t)
+
+	broker.publish("home/livingroom/temperature", []byte("21"), false)
+	broker.publish("home/livingroomlamp", []byte("on"), false)
+	broker.publish("home/kitchen/light", []byte("off"), false)
+	waitFor(t, "home/livingroom/temperature")
+	waitFor(t, "home/livingroomlamp")
+	waitFor(t, "home/kitchen/light")
+
+	mux.RLock()
+	defer mux.RUnlock()
+	relevant := prefixRelevance("home/livingroom/")
+	for _, topic := range []string{"home", "home/livingroom", "home/livingroom/temperature"} {
+		if _, ok := relevant[lookupLocked(topic)]; !ok {
+			t.Errorf("%s not relevant", topic)
+		}
+	}
+	for _, topic := range []string{"home/livingroomlamp", "home/kitchen", "home/kitchen/light"} {
+		if _, ok := relevant[lookupLocked(topic)]; ok {
+			t.Errorf("%s relevant", topic)
+		}
+	}
+}
+
+func TestWithValuesHidesEmptyTopics(t *testing.T) {
+	resetTree(t)
+	connectTest(t)
+
+	broker.publish("a/full", []byte("1"), false)
+	broker.publish("a/empty", nil, false)
+	broker.publish("b/empty", nil, false)
+	waitFor(t, "a/full")
+	waitFor(t, "a/empty")
+	waitFor(t, "b/empty")
+
+	mux.RLock()
+	defer mux.RUnlock()
+	relevant := withValues(nil)
+	for _, topic := range []string{"a", "a/full"} {
+		if _, ok := relevant[lookupLocked(topic)]; !ok {
+			t.Errorf("%s hidden", topic)
+		}
+	}
+	for _, topic := range []string{"a/empty", "b", "b/empty"} {
+		if _, ok := relevant[lookupLocked(topic)]; ok {
+			t.Errorf("%s shown", topic)
+		}
+	}
+}
+
+func TestWithNumbers(t *testing.T) {
+	resetTree(t)
+	for _, m := range []exportedTopic{
+		{Topic: "a/temp", Payload: []byte("21.5")},
+		{Topic: "a/state", Payload: []byte("on")},
+		{Topic: "a/config", Payload: []byte(`{"x": 1}`)},
+		{Topic: "b/count", Payload: []byte("3")},
+		{Topic: "c/text", Payload: []byte("hello")},
+		{Topic: "a/nan", Payload: []byte("nan")},
+		{Topic: "a/inf", Payload: []byte("Infinity")},
+		{Topic: "a/hex", Payload: []byte("0x1p-2")},
+	} {
+		defaultHandler(nil, &forwardedMessage{m})
+	}
+	mux.Lock()
+	root.seed(splitTopic("a/seeded"))
+	mux.Unlock()
+
+	mux.RLock()
+	defer mux.RUnlock()
+	relevant := withNumbers(prefixRelevance("a/"))
+	for _, topic := range []string{"a", "a/temp"} {
+		if _, ok := relevant[lookupLocked(topic)]; !ok {
+			t.Errorf("%s hidden", topic)
+		}
+	}
+	for _, topic := range []string{"a/state", "a/config", "a/nan", "a/inf", "a/hex", "a/seeded", "b", "b/count", "c", "c/text"} {
+		if _, ok := relevant[lookupLocked(topic)]; ok {
+			t.Errorf("%s shown", topic)
+		}
+	}
+	if _, ok := withNumbers(nil)[lookupLocked("a/seeded")]; ok {
+		t.Error("topic without a message shown")
+	}
+}
+
+func TestCustomDelimiters(t *testing.T) {
+	resetTree(t)
+	*segmentDelimiterFlag = "."
+	defer func() { *segmentDelimiterFlag = "" }()
+	connectTest(t)
+
+	broker.publish("plant/line1.press.temp", []byte("80"), false)
+	if v := waitFor(t, "plant/line1/press/temp"); v != "80" {
+		t.Errorf("plant/line1/press/temp = %s, want 80", v)
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	press := lookupLocked("plant/line1/press")
+	if p := press.path(); p != "plant/line1.press" {
+		t.Errorf("path = %s, want plant/line1.press", p)
+	}
+	if f := press.subscriptionFilter(); f != "plant/#" {
+		t.Errorf("subscription filter = %s, want plant/#", f)
+	}
+	if f := lookupLocked("plant").subscriptionFilter(); f != "plant/#" {
+		t.Errorf("subscription filter = %s, want plant/#", f)
+	}
+}
+
+func TestSubscriptionFilterMixedDelimiters(t *testing.T) {
+	resetTree(t)
+	*segmentDelimiterFlag = "."
+	defer func() { *segmentDelimiterFlag = "" }()
+	for _, topic := range []string{"plant/line1/press", "plant/line1.x", "plant/line1/a", "plant/line1/b"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	// Whichever child comes first, plant/line1/# would miss plant/line1.x.
+	for i := 0; i < 20; i++ {
+		if f := lookupLocked("plant/line1").subscriptionFilter(); f != "plant/#" {
+			t.Fatalf("subscription filter = %s, want plant/#", f)
+		}
+	}
+}
+
+func TestCountLeaves(t *testing.T) {
+	resetTree(t)
+	for _, topic := range []string{"a/b/c", "a/b/d/e", "a/f", "g"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+	mux.RLock()
+	defer mux.RUnlock()
+	if got := lookupLocked("a").countLeaves(nil); got != 3 {
+		t.Errorf("countLeaves(nil) = %d, want 3", got)
+	}
+	filter := map[*topic]int{lookupLocked("a/b/c"): 1, lookupLocked("a/f"): 1}
+	if got := lookupLocked("a").countLeaves(filter); got != 2 {
+		t.Errorf("countLeaves(filter) = %d, want 2", got)
+	}
+}
+
+func TestCountShown(t *testing.T) {
+	resetTree(t)
+	for _, topic := range []string{"a/b", "a/c", "d"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+	mux.RLock()
+	defer mux.RUnlock()
+	if got := countShown(nil); got != "showing 3 of 3 topics" {
+		t.Errorf("countShown(nil) = %q", got)
+	}
+	relevant := map[*topic]int{lookupLocked("a"): 1, lookupLocked("a/b"): 1}
+	if got := countShown(relevant); got != "showing 1 of 3 topics" {
+		t.Errorf("countShown() = %q", got)
+	}
+}
+
+func TestSegmentRelevance(t *testing.T) {
+	resetTree(t)
+	connectTest(t)
+
+	broker.publish("home/livingroom/temperature", []byte("21"), false)
+	broker.publish("home/livingroom/humidity", []byte("40"), false)
+	broker.publish("home/kitchen/temperature", []byte("19"), false)
+	waitFor(t, "home/livingroom/temperature")
+	waitFor(t, "home/livingroom/humidity")
+	waitFor(t, "home/kitchen/temperature")
+
+	mux.RLock()
+	defer mux.RUnlock()
+	relevant := segmentRelevance("Living temp")
+	for _, topic := range []string{"home", "home/livingroom", "home/livingroom/temperature"} {
+		if _, ok := relevant[lookupLocked(topic)]; !ok {
+			t.Errorf("%s not relevant", topic)
+		}
+	}
+	for _, topic := range []string{"home/livingroom/humidity", "home/kitchen", "home/kitchen/temperature"} {
+		if _, ok := relevant[lookupLocked(topic)]; ok {
+			t.Errorf("%s relevant", topic)
+		}
+	}
+}
+
+func TestCompactChain(t *testing.T) {
+	resetTree(t)
+	defer func() { compactChains, maxDepth = false, 0 }()
+	for _, topic := range []string{"a/b/c/d/x", "a/b/c/d/y", "a/b/z"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	a, c := lookupLocked("a"), lookupLocked("a/b/c")
+	tests := []struct {
+		compact  bool
+		maxDepth int32
+		start    *topic
+		end      string
+		label    string
+		skipped  int
+	}{
+		{false, 0, a, "a", "a", 0},
+		{true, 0, a, "a/b", "a/b", 1},
+		{true, 0, c, "a/b/c/d", "c/d", 1},
+		{true, 2, a, "a", "a", 0},
+	}
+	for _, tt := range tests {
+		compactChains, maxDepth = tt.compact, tt.maxDepth
+		depth := len(tt.start.ancestors())
+		n, label, skipped := tt.start.compactChain(nil, depth)
+		if n.path() != tt.end || label != tt.label || skipped != tt.skipped {
+			t.Errorf("compactChain(%s) with compact %t, max depth %d = %s, %s, %d, want %s, %s, %d",
+				tt.start.path(), tt.compact, tt.maxDepth, n.path(), label, skipped, tt.end, tt.label, tt.skipped)
+		}
+	}
+}
+
+func TestSearchScope(t *testing.T) {
+	resetTree(t)
+	defer func() { searchScope = nil }()
+	for _, topic := range []string{"home/kitchen/temperature", "office/temperature"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("21")}})
+	}
+
+	mux.Lock()
+	searchScope = lookupLocked("home")
+	for name, relevance := range map[string]func(string) map[*topic]int{
+		"leaf": leafRelevance, "subtree": subtreeRelevance, "prefix": prefixRelevance, "segment": segmentRelevance,
+	} {
+		term := "temperature"
+		if name == "prefix" {
+			term = "home/"
+		}
+		relevant := relevance(term)
+		if _, ok := relevant[lookupLocked("home/kitchen/temperature")]; !ok {
+			t.Errorf("%s: topic in scope not relevant", name)
+		}
+		if _, ok := relevant[lookupLocked("office/temperature")]; ok {
+			t.Errorf("%s: topic outside of scope relevant", name)
+		}
+	}
+	mux.Unlock()
+
+	clearTree(false)
+	mux.RLock()
+	if searchRoot() != &root {
+		t.Error("scope kept after clearing the tree")
+	}
+	mux.RUnlock()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var sparkplugFlag = flag.Bool("sparkplug", false, "decode Sparkplug B payloads on spBv1.0 topics")
+
+// sparkplugTypes are the Sparkplug message types carrying protobuf payloads.
+var sparkplugTypes = map[string]bool{
+	"NBIRTH": true, "NDEATH": true, "NDATA": true, "NCMD": true,
+	"DBIRTH": true, "DDEATH": true, "DDATA": true, "DCMD": true,
+}
+
+// isSparkplugTopic reports whether topic carries a Sparkplug B payload, that
+// is it has the form spBv1.0/group/type/node[/device].
+func isSparkplugTopic(topic string) bool {
+	parts := strings.Split(topic, "/")
+	return len(parts) >= 4 && parts[0] == "spBv1.0" && sparkplugTypes[parts[2]]
+}
+
+// sparkplugDataTypes names the metric data types of Sparkplug B, indexed by
+// their number.
+var sparkplugDataTypes = []string{
+	"", "Int8", "Int16", "Int32", "Int64", "UInt8", "UInt16", "UInt32", "UInt64",
+	"Float", "Double", "Boolean", "String", "DateTime", "Text", "UUID",
+	"DataSet", "Bytes", "File", "Template",
+}
+
+// sparkplugPayload is the decoded form of the Payload message.
+type sparkplugPayload struct {
+	Timestamp *uint64           `json:"timestamp,omitempty"`
+	Seq       *uint64           `json:"seq,omitempty"`
+	UUID      string            `json:"uuid,omitempty"`
+	Metrics   []sparkplugMetric `json:"metrics"`
+	Body      []byte            `json:"body,omitempty"`
+}
+
+// sparkplugMetric is the decoded form of the Metric message. Metadata and
+// properties are not decoded.
+type sparkplugMetric struct {
+	Name      string      `json:"name,omitempty"`
+	Alias     *uint64     `json:"alias,omitempty"`
+	Timestamp *uint64     `json:"timestamp,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Value     interface{} `json:"value"`
+}
+
+// decodeSparkplug decodes a Sparkplug B payload into JSON.
+func decodeSparkplug(b []byte) (string, error) {
+	var p sparkplugPayload
+	err := readProtobuf(b, func(num int, f protoField) error {
+		switch num {
+		case 1:
+			p.Timestamp = f.uint64p()
+		case 2:
+			m, err := decodeSparkplugMetric(f.bytes)
+			if err != nil {
+				return err
+			}
+			p.Metrics = append(p.Metrics, m)
+		case 3:
+			p.Seq = f.uint64p()
+		case 4:
+			p.UUID = string(f.bytes)
+		case 5:
+			p.Body = f.bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	j, err := json.Marshal(p)
+	return string(j), err
+}
+
+func decodeSparkplugMetric(b []byte) (sparkplugMetric, error) {
+	var m sparkplugMetric
+	var dataType uint64
+	var value *protoField
+	var valueNum int
+	isNull := false
+	err := readProtobuf(b, func(num int, f protoField) error {
+		switch {
+		case num == 1:
+			m.Name = string(f.bytes)
+		case num == 2:
+			m.Alias = f.uint64p()
+		case num == 3:
+			m.Timestamp = f.uint64p()
+		case num == 4:
+			dataType = f.value
+		case num == 7:
+			isNull = f.value != 0
+		case num >= 10 && num <= 19:
+			value, valueNum = &f, num
+		}
+		return nil
+	})
+	if err != nil {
+		return m, err
+	}
+
+	if dataType < uint64(len(sparkplugDataTypes)) {
+		m.Type = sparkplugDataTypes[dataType]
+	} else {
+		m.Type = fmt.Sprintf("type %d", dataType)
+	}
+	if value == nil || isNull {
+		return m, nil
+	}
+
+	switch valueNum {
+	case 10: // int_value, signed types in two's complement
+		switch m.Type {
+		case "Int8":
+			m.Value = int8(value.value)
+		case "Int16":
+			m.Value = int16(value.value)
+		case "Int32":
+			m.Value = int32(value.value)
+		default:
+			m.Value = uint32(value.value)
+		}
+	case 11: // long_value
+		if m.Type == "Int64" {
+			m.Value = int64(value.value)
+		} else {
+			m.Value = value.value
+		}
+	case 12:
+		m.Value = math.Float32frombits(uint32(value.value))
+	case 13:
+		m.Value = math.Float64frombits(value.value)
+	case 14:
+		m.Value = value.value != 0
+	case 15:
+		m.Value = string(value.bytes)
+	case 16:
+		m.Value = value.bytes
+	default: // data sets, templates and extensions
+		m.Value = fmt.Sprintf("<%s, %d bytes>", m.Type, len(value.bytes))
+	}
+	return m, nil
+}
+
+// protoField is a field of a protobuf message. Varint and fixed size values
+// are stored in value, length-delimited ones in bytes.
+type protoField struct {
+	value uint64
+	bytes []byte
+}
+
+func (f protoField) uint64p() *uint64 {
+	v := f.value
+	return &v
+}
+
+var errProtobuf = errors.New("malformed protobuf")
+
+// readProtobuf calls fn for every field of the protobuf message b.
+func readProtobuf(b []byte, fn func(num int, f protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtobuf
+		}
+		b = b[n:]
+
+		var f protoField
+		switch key & 7 {
+		case 0: // varint
+			if f.value, n = binary.Uvarint(b); n <= 0 {
+				return errProtobuf
+			}
+			b = b[n:]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return errProtobuf
+			}
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errProtobuf
+			}
+			f.bytes, b = b[n:n+int(l)], b[n+int(l):]
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return errProtobuf
+			}
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return errProtobuf
+		}
+		if key>>3 == 0 {
+			return errProtobuf
+		}
+		if err := fn(int(key>>3), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
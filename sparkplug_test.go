@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// protoBuf builds protobuf messages for the tests.
+type protoBuf []byte
+
+func (p protoBuf) uvarint(v uint64) protoBuf {
+	b := make([]byte, binary.MaxVarintLen64)
+	return append(p, b[:binary.PutUvarint(b, v)]...)
+}
+
+func (p protoBuf) varint(num int, v uint64) protoBuf {
+	return p.uvarint(uint64(num) << 3).uvarint(v)
+}
+
+func (p protoBuf) fixed64(num int, v uint64) protoBuf {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return append(p.uvarint(uint64(num)<<3|1), b...)
+}
+
+func (p protoBuf) fixed32(num int, v uint32) protoBuf {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return append(p.uvarint(uint64(num)<<3|5), b...)
+}
+
+func (p protoBuf) bytes(num int, b []byte) protoBuf {
+	return append(p.uvarint(uint64(num)<<3|2).uvarint(uint64(len(b))), b...)
+}
+
+func TestDecodeSparkplug(t *testing.T) {
+	temp := protoBuf{}.bytes(1, []byte("temperature")).varint(4, 9).fixed32(12, math.Float32bits(21.5))
+	offset := protoBuf{}.bytes(1, []byte("offset")).varint(2, 3).varint(4, 1).varint(10, 0xfe)
+	count := protoBuf{}.varint(2, 4).varint(4, 4).varint(11, math.MaxUint64)
+	status := protoBuf{}.bytes(1, []byte("status")).varint(4, 12).bytes(15, []byte("ok"))
+	missing := protoBuf{}.bytes(1, []byte("missing")).varint(4, 10).varint(7, 1)
+	avg := protoBuf{}.bytes(1, []byte("avg")).varint(4, 10).fixed64(13, math.Float64bits(0.25))
+	payload := protoBuf{}.varint(1, 1682942400000).
+		bytes(2, temp).bytes(2, offset).bytes(2, count).bytes(2, status).bytes(2, missing).bytes(2, avg).
+		varint(3, 7)
+
+	got, err := decodeSparkplug(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"timestamp":1682942400000,"seq":7,"metrics":[` +
+		`{"name":"temperature","type":"Float","value":21.5},` +
+		`{"name":"offset","alias":3,"type":"Int8","value":-2},` +
+		`{"alias":4,"type":"Int64","value":-1},` +
+		`{"name":"status","type":"String","value":"ok"},` +
+		`{"name":"missing","type":"Double","value":null},` +
+		`{"name":"avg","type":"Double","value":0.25}]}`
+	if got != want {
+		t.Errorf("decodeSparkplug = %s\nwant %s", got, want)
+	}
+}
+
+func TestDecodeSparkplugMalformed(t *testing.T) {
+	for _, b := range [][]byte{{0x12, 0x05, 0x0a}, {0x0b}, {0x08}} {
+		if _, err := decodeSparkplug(b); err == nil {
+			t.Errorf("decodeSparkplug(%x) succeeded, want error", b)
+		}
+	}
+}
+
+func TestIsSparkplugTopic(t *testing.T) {
+	tests := map[string]bool{
+		"spBv1.0/plant/DDATA/edge1/press": true,
+		"spBv1.0/plant/NBIRTH/edge1":      true,
+		"spBv1.0/STATE/scada":             false,
+		"spBv1.0/plant/DDATA":             false,
+		"spAv1.0/plant/DDATA/edge1":       false,
+	}
+	for topic, want := range tests {
+		if got := isSparkplugTopic(topic); got != want {
+			t.Errorf("isSparkplugTopic(%s) = %t, want %t", topic, got, want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var dimAfterFlag = flag.Duration("dim-after", 0, "dim topics that haven't been updated for this long, 0 never dims them")
+
+// staleAlpha is the opacity of stale topics.
+const staleAlpha = 0.45
+
+// stale reports whether t hasn't been updated for -dim-after at now.
+func (t *topic) stale(now time.Time) bool {
+	return *dimAfterFlag > 0 && !t.lastSeen.IsZero() && now.Sub(t.lastSeen) >= *dimAfterFlag
+}
+
+// dimmed returns w drawn with reduced opacity if t is stale.
+func (t *topic) dimmed(w g.Widget, now time.Time) g.Widget {
+	if !t.stale(now) {
+		return w
+	}
+	return g.Style().SetStyleFloat(g.StyleVarAlpha, staleAlpha).To(w)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStale(t *testing.T) {
+	defer func(d time.Duration) { *dimAfterFlag = d }(*dimAfterFlag)
+	now := time.Now()
+	n := &topic{lastSeen: now.Add(-time.Minute)}
+
+	*dimAfterFlag = 0
+	if n.stale(now) {
+		t.Error("stale without -dim-after")
+	}
+	*dimAfterFlag = 2 * time.Minute
+	if n.stale(now) {
+		t.Error("stale before -dim-after passed")
+	}
+	*dimAfterFlag = time.Minute
+	if !n.stale(now) {
+		t.Error("not stale after -dim-after passed")
+	}
+	if (&topic{}).stale(now) {
+		t.Error("topic without messages stale")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var (
+	throughputWindowFlag = flag.Duration("throughput-window", 5*time.Minute, "time span covered by the throughput graph")
+	activeWindowFlag     = flag.Duration("active-window", time.Minute, "count the topics updated within this time span as active in the status line")
+)
+
+var (
+	// messageCount is the number of messages received so far. It must be
+	// accessed atomically.
+	messageCount uint64
+
+	statsMux       sync.Mutex
+	lastCount      uint64
+	throughput     []float64 // messages per second, oldest first
+	showThroughput bool
+
+	// activeTopics is the number of topics updated within -active-window.
+	activeTopics int
+)
+
+func countMessage() {
+	atomic.AddUint64(&messageCount, 1)
+}
+
+// sampleStats records the number of messages received since the last call.
+// It is called once per second.
+func sampleStats() {
+	n := atomic.LoadUint64(&messageCount)
+	mux.RLock()
+	active := countActive(time.Now().Add(-*activeWindowFlag))
+	mux.RUnlock()
+
+	statsMux.Lock()
+	activeTopics = active
+	defer statsMux.Unlock()
+	throughput = append(throughput, float64(n-lastCount))
+	lastCount = n
+	if max := int(*throughputWindowFlag / time.Second); len(throughput) > max {
+		throughput = throughput[len(throughput)-max:]
+	}
+}
+
+// countActive returns the number of topics updated after since. The caller
+// must hold mux.
+func countActive(since time.Time) int {
+	n := 0
+	root.walk(func(t *topic) {
+		if t.last != nil && t.lastSeen.After(since) {
+			n++
+		}
+	})
+	return n
+}
+
+// activeSummary returns the number of active topics for the status line.
+func activeSummary() string {
+	statsMux.Lock()
+	defer statsMux.Unlock()
+	return fmt.Sprintf("%d topics active in the last %s", activeTopics, *activeWindowFlag)
+}
+
+// throughputPlot plots the messages received per second over the last
+// -throughput-window.
+func throughputPlot() g.Widget {
+	statsMux.Lock()
+	data := append([]float64(nil), throughput...)
+	statsMux.Unlock()
+
+	max := 1.0
+	for _, v := range data {
+		if v > max {
+			max = v
+		}
+	}
+
+	window := throughputWindowFlag.Seconds()
+	return g.Plot("Throughput").
+		AxisLimits(-window, 0, 0, max*1.1, g.ConditionAlways).
+		Flags(g.PlotFlagsNoLegend).
+		Size(-1, 150).
+		Plots(g.Line("msg/s", data).X0(float64(1 - len(data))))
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountActive(t *testing.T) {
+	resetTree(t)
+	for _, topic := range []string{"a/fresh", "a/stale", "b"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	lookupLocked("a/stale").lastSeen = time.Now().Add(-time.Hour)
+	if got := countActive(time.Now().Add(-time.Minute)); got != 2 {
+		t.Errorf("countActive() = %d, want 2", got)
+	}
+}
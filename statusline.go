@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	statusLineFlag     = flag.Bool("status-line", false, "run headless and print a one-line summary to stdout regularly, for status bars such as tmux or polybar")
+	statusIntervalFlag = flag.Duration("status-interval", 5*time.Second, "time between the lines printed with -status-line")
+)
+
+// writeStatusLine writes the summary printed with -status-line: the number
+// of topics, the messages per second and whether zapper is connected.
+func writeStatusLine(w io.Writer, topics int, rate float64, connected bool) error {
+	state := "connected"
+	if !connected {
+		state = "disconnected"
+	}
+	_, err := fmt.Fprintf(w, "%d topics %.1f msg/s %s\n", topics, rate, state)
+	return err
+}
+
+// printStatusLines prints the summary every -status-interval and never
+// returns.
+func printStatusLines() {
+	last, lastAt := atomic.LoadUint64(&messageCount), time.Now()
+	for range time.Tick(*statusIntervalFlag) {
+		n, now := atomic.LoadUint64(&messageCount), time.Now()
+		rate := float64(n-last) / now.Sub(lastAt).Seconds()
+		last, lastAt = n, now
+
+		mux.RLock()
+		topics := root.countLeaves(nil)
+		mux.RUnlock()
+		c, _ := currentClient()
+		if err := writeStatusLine(os.Stdout, topics, rate, c != nil && c.IsConnectionOpen()); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
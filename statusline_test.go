@@ -0,0 +1,19 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteStatusLine(t *testing.T) {
+	var b strings.Builder
+	if err := writeStatusLine(&b, 42, 3.25, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStatusLine(&b, 0, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "42 topics 3.2 msg/s connected\n0 topics 0.0 msg/s disconnected\n"; got != want {
+		t.Errorf("status lines = %q, want %q", got, want)
+	}
+}
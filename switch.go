@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var (
+	// brokerInput is the broker URL edited in the GUI.
+	brokerInput string
+
+	// keepTreeOnSwitch keeps the topics of the previous broker when
+	// switching to another one.
+	keepTreeOnSwitch bool
+
+	// switching is 1 while switchBroker runs, and switches counts how
+	// often it started. They must be accessed atomically.
+	switching int32
+	switches  uint64
+)
+
+// brokerSwitcher returns the field to switch to another broker, or nothing
+// if zapper doesn't connect to a broker.
+func brokerSwitcher() g.Widget {
+	if _, cfg := currentClient(); cfg.Broker == "" {
+		return g.Layout{}
+	}
+	connect := func() { go switchBroker(brokerInput, keepTreeOnSwitch) }
+	return g.Layout{
+		g.InputText(&brokerInput).Hint("tcp://host:1883").Size(250).
+			Flags(g.InputTextFlagsEnterReturnsTrue).OnChange(connect),
+		g.SmallButton("Connect").OnClick(connect),
+		g.Checkbox("Keep tree", &keepTreeOnSwitch),
+	}
+}
+
+// switchBroker disconnects from the current broker and connects to the one
+// at url with the same settings otherwise. The rules of the config file are
+// loaded again for the new broker and applied to the topics kept in the
+// tree. If connecting fails, zapper stays
+// disconnected, the status tells why and another broker can be tried.
+func switchBroker(url string, keep bool) {
+	old, cfg := currentClient()
+	if cfg.Broker == "" || url == "" {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&switching, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&switching, 0)
+
+	setStatus("switching to %s", url)
+	// Nothing may use the old client once it is disconnected, and its
+	// reconnect loop gives up.
+	atomic.AddUint64(&switches, 1)
+	setClient(nil, cfg)
+	if old != nil {
+		old.Disconnect(250)
+	}
+
+	if !keep {
+		clearTree(false)
+	}
+	mux.Lock()
+	brokerFlags = brokerList{url}
+	err := loadRulesFor(url)
+	mux.Unlock()
+	if err != nil {
+		log.Println(err)
+	}
+
+	cfg.Broker, cfg.Fallbacks = url, nil
+	c, err := Connect(cfg)
+	if err != nil {
+		setClient(nil, cfg)
+		setStatus("disconnected, connecting to %s failed: %v", url, err)
+		return
+	}
+	setClient(c, cfg)
+	// -idle-timeout applies to the new connection from the start.
+	atomic.StoreInt32(&idleDisconnected, 0)
+	touchIdle(time.Now())
+	setStatus("connected to %s", connectedBroker())
+}
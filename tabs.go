@@ -0,0 +1,76 @@
+package main
+
+import g "github.com/AllenDang/giu"
+
+// splitRetained shows topics in two tabs, one for those first seen in a
+// retained message, which usually hold configuration and state, and one for
+// live telemetry. Each tab keeps its own search term.
+var splitRetained bool
+
+// tab is a tab of the split tree.
+type tab int
+
+const (
+	tabRetained tab = iota
+	tabLive
+)
+
+var (
+	// currentTab is the tab whose search term and topics are shown.
+	currentTab = tabRetained
+
+	// openTab is the tab imgui showed in the last frame. The switch to it
+	// waits for the next frame, since the search field of the toolbar is
+	// built before the tabs.
+	openTab = tabRetained
+
+	// tabTerms are the search terms of the tabs not shown.
+	tabTerms [2]string
+)
+
+// selectTab switches to tab k, swapping in its search term.
+func selectTab(k tab) {
+	if k == currentTab {
+		return
+	}
+	tabTerms[currentTab] = fuzzyTerm
+	fuzzyTerm = tabTerms[k]
+	currentTab = k
+}
+
+// selectOpenTab switches to the tab opened in the last frame. It is called
+// before the toolbar is built.
+func selectOpenTab() {
+	if splitRetained {
+		selectTab(openTab)
+	}
+}
+
+// inCurrentTab narrows relevant down to the topics of the current tab if the
+// tree is split. A nil relevant map considers all topics.
+func inCurrentTab(relevant map[*topic]int) map[*topic]int {
+	if !splitRetained {
+		return relevant
+	}
+	retained := currentTab == tabRetained
+	return narrow(relevant, func(t *topic) bool { return t.firstRetained == retained })
+}
+
+// tabbedTree returns the tree split into tabs. A newly opened tab stays
+// empty for a frame, until selectOpenTab switched to it.
+func tabbedTree() g.Widget {
+	item := func(label string, k tab) *g.TabItemWidget {
+		return g.TabItem(label).Layout(g.Custom(func() {
+			openTab = k
+			if k != currentTab {
+				refresh()
+				return
+			}
+			treeView().Build()
+		}))
+	}
+	return g.TabBar().TabItems(
+		item("Retained", tabRetained),
+		item("Live", tabLive),
+	)
+}
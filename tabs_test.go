@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestSplitRetained(t *testing.T) {
+	resetTree(t)
+	defer func() { splitRetained, currentTab, fuzzyTerm, tabTerms = false, tabRetained, "", [2]string{} }()
+
+	broker.publish("device/config", []byte(`{"interval":5}`), true)
+	connectTest(t)
+	broker.publish("device/temperature", []byte("21"), false)
+	waitFor(t, "device/temperature")
+	waitFor(t, "device/config")
+
+	splitRetained = true
+	tests := []struct {
+		tab      tab
+		shown    string
+		notShown string
+	}{
+		{tabRetained, "device/config", "device/temperature"},
+		{tabLive, "device/temperature", "device/config"},
+	}
+	for _, tt := range tests {
+		selectTab(tt.tab)
+		mux.RLock()
+		relevant := relevance()
+		if _, ok := relevant[lookupLocked(tt.shown)]; !ok {
+			t.Errorf("tab %d: %s not relevant", tt.tab, tt.shown)
+		}
+		if _, ok := relevant[lookupLocked(tt.notShown)]; ok {
+			t.Errorf("tab %d: %s relevant", tt.tab, tt.notShown)
+		}
+		mux.RUnlock()
+	}
+}
+
+func TestSelectTabKeepsSearchTerms(t *testing.T) {
+	defer func() { currentTab, fuzzyTerm, tabTerms = tabRetained, "", [2]string{} }()
+
+	fuzzyTerm = "config"
+	selectTab(tabLive)
+	if fuzzyTerm != "" {
+		t.Errorf("live tab search = %q, want empty", fuzzyTerm)
+	}
+	fuzzyTerm = "temp"
+	selectTab(tabRetained)
+	if fuzzyTerm != "config" {
+		t.Errorf("retained tab search = %q, want config", fuzzyTerm)
+	}
+	selectTab(tabLive)
+	if fuzzyTerm != "temp" {
+		t.Errorf("live tab search = %q, want temp", fuzzyTerm)
+	}
+}
+
+func TestSelectOpenTab(t *testing.T) {
+	defer func() {
+		splitRetained, currentTab, openTab, fuzzyTerm, tabTerms = false, tabRetained, tabRetained, "", [2]string{}
+	}()
+	splitRetained = true
+	fuzzyTerm = "config"
+
+	openTab = tabLive
+	selectOpenTab()
+	if currentTab != tabLive || fuzzyTerm != "" {
+		t.Errorf("after opening the live tab, current tab %d, search %q", currentTab, fuzzyTerm)
+	}
+
+	splitRetained = false
+	openTab = tabRetained
+	selectOpenTab()
+	if currentTab != tabLive {
+		t.Error("tab switched although the tree isn't split")
+	}
+}
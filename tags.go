@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	g "github.com/AllenDang/giu"
+)
+
+// tagColors are the color tags that can be assigned to rows, in menu order,
+// packed as expected by imgui.
+var tagColors = []struct {
+	name  string
+	color uint32
+}{
+	{"red", 0x603c3ce0},
+	{"orange", 0x60308ce8},
+	{"yellow", 0x6038d8e0},
+	{"green", 0x6050c050},
+	{"blue", 0x60e08c40},
+	{"purple", 0x60c05ca8},
+}
+
+// tags maps topic paths to the name of the color tag assigned to their row.
+// It is protected by mux.
+var tags = make(map[string]string)
+
+// tagsPath returns the path of the file storing the color tags of all
+// brokers.
+func tagsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "zapper", "tags.json"), nil
+}
+
+// readTags returns the color tags stored in the file name by broker. A
+// missing file has no tags.
+func readTags(name string) (map[string]map[string]string, error) {
+	all := make(map[string]map[string]string)
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return all, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("invalid tags %s: %w", name, err)
+	}
+	return all, nil
+}
+
+// writeTags stores the color tags of broker in the file name, keeping those
+// of other brokers.
+func writeTags(name, broker string, t map[string]string) error {
+	all, err := readTags(name)
+	if err != nil {
+		return err
+	}
+	if len(t) == 0 {
+		delete(all, broker)
+	} else {
+		all[broker] = t
+	}
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0o644)
+}
+
+// loadTags replaces the color tags with those stored for the broker of the
+// config file rules.
+func loadTags() error {
+	name, err := tagsPath()
+	if err != nil {
+		return nil
+	}
+	all, err := readTags(name)
+	if err != nil {
+		return err
+	}
+	tags = all[configBroker()]
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	return nil
+}
+
+// setTag assigns the color tag to the row of t and stores the tags of the
+// broker, an empty tag removes it.
+func setTag(t *topic, tag string) {
+	mux.Lock()
+	if tag == "" {
+		delete(tags, t.topicPath())
+	} else {
+		tags[t.topicPath()] = tag
+	}
+	saved := make(map[string]string, len(tags))
+	for k, v := range tags {
+		saved[k] = v
+	}
+	mux.Unlock()
+	refresh()
+
+	name, err := tagsPath()
+	if err == nil {
+		err = writeTags(name, configBroker(), saved)
+	}
+	if err != nil {
+		log.Println("saving color tags:", err)
+	}
+}
+
+// tagColor returns the color of the tag assigned to t. The caller must hold
+// mux.
+func (t *topic) tagColor() (uint32, bool) {
+	tag, ok := tags[t.topicPath()]
+	if !ok {
+		return 0, false
+	}
+	for _, c := range tagColors {
+		if c.name == tag {
+			return c.color, true
+		}
+	}
+	return 0, false
+}
+
+// tagMenu returns the submenu to assign a color tag to the row of t. The
+// caller must hold mux.
+func (t *topic) tagMenu() g.Widget {
+	current := tags[t.topicPath()]
+	items := g.Layout{
+		g.MenuItem("None").Selected(current == "").OnClick(func() { setTag(t, "") }),
+	}
+	for _, c := range tagColors {
+		name := c.name
+		items = append(items, g.MenuItem(name).Selected(current == name).OnClick(func() { setTag(t, name) }))
+	}
+	return g.Menu("Color tag").Layout(items...)
+}
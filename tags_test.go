@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteTags(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "zapper", "tags.json")
+	if err := writeTags(name, "tcp://a:1883", map[string]string{"home/temp": "red"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTags(name, "tcp://b:1883", map[string]string{"plant/press": "blue"}); err != nil {
+		t.Fatal(err)
+	}
+	all, err := readTags(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"tcp://a:1883": {"home/temp": "red"},
+		"tcp://b:1883": {"plant/press": "blue"},
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("tags = %v, want %v", all, want)
+	}
+
+	if err := writeTags(name, "tcp://a:1883", nil); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := readTags(name); len(all) != 1 || all["tcp://a:1883"] != nil {
+		t.Errorf("tags after removing those of a = %v, want only b", all)
+	}
+}
+
+func TestTagColor(t *testing.T) {
+	resetTree(t)
+	defer func(m map[string]string) { tags = m }(tags)
+	tags = map[string]string{"home/temp": "green", "home/hum": "unknown"}
+	for _, topic := range []string{"home/temp", "home/hum"} {
+		defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: topic, Payload: []byte("1")}})
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	if _, ok := lookupLocked("home/temp").tagColor(); !ok {
+		t.Error("home/temp has no tag color")
+	}
+	if _, ok := lookupLocked("home/hum").tagColor(); ok {
+		t.Error("unknown tag has a color")
+	}
+	if _, ok := lookupLocked("home").tagColor(); ok {
+		t.Error("untagged branch has a tag color")
+	}
+}
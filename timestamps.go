@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var timestampFormatFlag = flag.String("timestamp-format", "relative", "format of the last seen column: relative, rfc3339 or time-only")
+
+// timestampFormats are the formats of the last seen column, selected by
+// timestampFormat.
+var timestampFormats = []string{"relative", "rfc3339", "time-only"}
+
+var timestampFormat int32
+
+// setTimestampFormat selects the format of the last seen column by name.
+func setTimestampFormat(name string) error {
+	for i, f := range timestampFormats {
+		if f == name {
+			timestampFormat = int32(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid -timestamp-format %q, must be relative, rfc3339 or time-only", name)
+}
+
+// timestampCombo switches the format of the last seen column.
+func timestampCombo() g.Widget {
+	return g.Combo("Last seen", timestampFormats[timestampFormat], timestampFormats, &timestampFormat).Size(100)
+}
+
+// formatLastSeen formats the time t a message arrived in the selected format.
+func formatLastSeen(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	switch timestampFormats[timestampFormat] {
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "time-only":
+		return t.Format("15:04:05")
+	}
+
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatLastSeen(t *testing.T) {
+	defer func() { timestampFormat = 0 }()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		format string
+		seen   time.Time
+		want   string
+	}{
+		{"relative", now.Add(-42 * time.Second), "42s ago"},
+		{"relative", now.Add(-90 * time.Minute), "1h ago"},
+		{"relative", now.Add(-50 * time.Hour), "2d ago"},
+		{"rfc3339", now, "2023-05-01T12:00:00Z"},
+		{"time-only", now.Add(time.Second), "12:00:01"},
+		{"relative", time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		if err := setTimestampFormat(tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if got := formatLastSeen(tt.seen, now); got != tt.want {
+			t.Errorf("%s: formatLastSeen(%v) = %q, want %q", tt.format, tt.seen, got, tt.want)
+		}
+	}
+	if err := setTimestampFormat("iso"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	tlsServerNameFlag = flag.String("tls-servername", "", "server name for SNI and certificate verification, defaults to the broker host")
+	tlsALPNFlag       = flag.String("tls-alpn", "", "comma-separated list of ALPN protocols to offer")
+	pkcs12Flag        = flag.String("pkcs12", "", "authenticate with the client certificate and key from this PKCS#12 (.p12, .pfx) file")
+	pkcs12PassFlag    = flag.String("pkcs12-password", "", "password of the -pkcs12 file")
+	certFileFlag      = flag.String("certfile", "", "authenticate with the client certificate from this PEM file, requires -keyfile")
+	keyFileFlag       = flag.String("keyfile", "", "PEM file with the private key of -certfile")
+	keyPassFlag       = flag.String("key-password", "", "password of an encrypted -keyfile")
+)
+
+// isTLSScheme reports whether paho connects to broker using TLS.
+func isTLSScheme(broker string) (bool, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return false, err
+	}
+	switch u.Scheme {
+	case "ssl", "tls", "mqtts", "mqtt+ssl", "tcps", "wss":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// tlsConfig builds the TLS configuration for cfg. It returns nil if no TLS
+// option was given.
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSServerName == "" && len(cfg.TLSALPN) == 0 && cfg.PKCS12 == "" && cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil, nil
+	}
+
+	secure, err := isTLSScheme(cfg.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker %q: %w", cfg.Broker, err)
+	}
+	if !secure {
+		return nil, fmt.Errorf("TLS options require a TLS broker scheme (ssl, tls, mqtts, wss), got %q", cfg.Broker)
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName: cfg.TLSServerName,
+		NextProtos: cfg.TLSALPN,
+	}
+	switch {
+	case cfg.PKCS12 != "" && (cfg.CertFile != "" || cfg.KeyFile != ""):
+		return nil, errors.New("-pkcs12 and -certfile/-keyfile are mutually exclusive")
+	case cfg.PKCS12 != "":
+		cert, err := loadPKCS12(cfg.PKCS12, cfg.PKCS12Password)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("-certfile and -keyfile must be given together")
+		}
+		cert, err := loadKeyPair(cfg.CertFile, cfg.KeyFile, cfg.KeyPassword)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// loadKeyPair loads a client certificate and its private key from PEM files.
+// An encrypted key, either PKCS#8 or legacy PEM encryption, is decrypted with
+// password.
+func loadKeyPair(certFile, keyFile, password string) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyPEM, err = decryptKey(keyPEM, password); err != nil {
+		return tls.Certificate{}, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("loading %s and %s: %w", certFile, keyFile, err)
+	}
+	return cert, nil
+}
+
+// decryptKey returns the first private key found in keyPEM, decrypted with
+// password if it is encrypted.
+func decryptKey(keyPEM []byte, password string) ([]byte, error) {
+	var block *pem.Block
+	for rest := keyPEM; ; {
+		if block, rest = pem.Decode(rest); block == nil {
+			return nil, errors.New("no private key found")
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			break
+		}
+	}
+
+	// Legacy PEM encryption is deprecated as insecure, but keys encrypted
+	// that way are still around.
+	legacy := x509.IsEncryptedPEMBlock(block)
+	if block.Type != "ENCRYPTED PRIVATE KEY" && !legacy {
+		return pem.EncodeToMemory(block), nil
+	}
+	if password == "" {
+		return nil, errors.New("private key is encrypted, set its password with -key-password or ZAPPER_KEY_PASSWORD")
+	}
+
+	if legacy {
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		// The padding check misses some wrong passwords, parsing doesn't.
+		if errors.Is(err, x509.IncorrectPasswordError) || err == nil && !isPrivateKey(der) {
+			return nil, errors.New("wrong -key-password")
+		} else if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+	}
+
+	key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	if err != nil {
+		// Decrypting with the wrong password yields garbage, which fails
+		// either the padding check or parsing.
+		return nil, fmt.Errorf("wrong -key-password or unsupported encryption (%v)", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// loadPKCS12 loads a client certificate, its key and the CA certificates
+// completing its chain from the PKCS#12 file name.
+func loadPKCS12(name, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return tls.Certificate{}, fmt.Errorf("decoding %s: wrong password, set it with -pkcs12-password or ZAPPER_PKCS12_PASSWORD", name)
+	} else if err != nil {
+		return tls.Certificate{}, fmt.Errorf("decoding %s: %w", name, err)
+	}
+
+	c := tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+	for _, ca := range chain {
+		c.Certificate = append(c.Certificate, ca.Raw)
+	}
+	return c, nil
+}
+
+// isPrivateKey reports whether der is a private key in one of the formats
+// supported by tls.X509KeyPair.
+func isPrivateKey(der []byte) bool {
+	if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return true
+	}
+	if _, err := x509.ParseECPrivateKey(der); err == nil {
+		return true
+	}
+	_, err := x509.ParsePKCS8PrivateKey(der)
+	return err == nil
+}
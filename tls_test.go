@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// clientCert returns a self-signed client certificate and its key.
+func clientCert(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "zapper-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// writePKCS12 writes a PKCS#12 file with a self-signed client certificate
+// protected by password.
+func writePKCS12(t *testing.T, password string) (string, *x509.Certificate) {
+	t.Helper()
+	key, cert := clientCert(t)
+	data, err := pkcs12.Encode(rand.Reader, key, cert, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "client.p12")
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name, cert
+}
+
+func TestTLSConfigLoadsPKCS12(t *testing.T) {
+	name, cert := writePKCS12(t, "secret")
+	cfg := testConfig()
+	cfg.Broker = "ssl://localhost:8883"
+	cfg.PKCS12, cfg.PKCS12Password = name, "secret"
+
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsCfg.Certificates) != 1 || !tlsCfg.Certificates[0].Leaf.Equal(cert) {
+		t.Fatalf("certificates = %+v, want the one from %s", tlsCfg.Certificates, name)
+	}
+	if tlsCfg.Certificates[0].PrivateKey == nil {
+		t.Error("private key missing")
+	}
+}
+
+func TestTLSConfigRejectsWrongPKCS12Password(t *testing.T) {
+	name, _ := writePKCS12(t, "secret")
+	cfg := testConfig()
+	cfg.Broker = "ssl://localhost:8883"
+	cfg.PKCS12, cfg.PKCS12Password = name, "wrong"
+
+	_, err := tlsConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Errorf("tlsConfig() error = %v, want wrong password", err)
+	}
+}
+
+// writeKeyPair writes a self-signed client certificate and its key to PEM
+// files. The key is encrypted with password using either PKCS#8 or legacy
+// PEM encryption, unless password is empty.
+func writeKeyPair(t *testing.T, password string, legacy bool) (string, string) {
+	t.Helper()
+	key, cert := clientCert(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	switch {
+	case password != "" && legacy:
+		ecDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err = x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", ecDER, []byte(password), x509.PEMCipherAES256)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case password != "":
+		der, err := pkcs8.MarshalPrivateKey(key, []byte(password), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestLoadKeyPair(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		legacy   bool
+		given    string
+		wantErr  string
+	}{
+		{"unencrypted", "", false, "", ""},
+		{"PKCS#8", "secret", false, "secret", ""},
+		{"PKCS#8 wrong password", "secret", false, "wrong", "wrong -key-password"},
+		{"legacy", "secret", true, "secret", ""},
+		{"legacy wrong password", "secret", true, "wrong", "wrong -key-password"},
+		{"missing password", "secret", false, "", "private key is encrypted"},
+	}
+	for _, tt := range tests {
+		certFile, keyFile := writeKeyPair(t, tt.password, tt.legacy)
+		cert, err := loadKeyPair(certFile, keyFile, tt.given)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if cert.PrivateKey == nil {
+			t.Errorf("%s: private key missing", tt.name)
+		}
+	}
+}
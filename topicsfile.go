@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+var topicsFileFlag = flag.String("topics-file", "", "pre-create the topics listed in this file, one per line, so the tree has its layout before messages arrive")
+
+// seedTopics adds the topics listed in the file name to the tree without a
+// message, so they count as neither received nor seen. Blank lines and lines
+// starting with # are skipped, as are topics outside -root.
+func seedTopics(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	topics, err := readTopics(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, topic := range topics {
+		rel, ok := belowRoot(topic)
+		if !ok {
+			continue
+		}
+		root.seed(splitTopic(rel))
+	}
+	return nil
+}
+
+// seed adds the topic below t made of parts to the tree, unless it exists.
+// The caller must hold mux.
+func (t *topic) seed(parts []segment) {
+	for _, p := range parts {
+		if t.children == nil {
+			t.children = make(map[string]*topic)
+		}
+		c, ok := t.children[p.name]
+		if !ok {
+			c = &topic{parent: t, name: p.name, sep: p.sep}
+			c.alias = aliasFor(c.topicPath())
+			t.children[p.name] = c
+		}
+		t = c
+	}
+}
+
+// seededRow returns the row of a leaf that was seeded but didn't receive a
+// message yet.
+func (t *topic) seededRow() *g.TreeTableRowWidget {
+	cells := []g.Widget{
+		t.tinted(g.Style().SetColor(g.StyleColorText, badgeColor).To(g.Label("no message yet"))),
+		g.ContextMenu().MouseButton(g.MouseButtonRight).Layout(
+			g.MenuItem("Copy topic").OnClick(func() { g.Context.GetPlatform().SetClipboard(t.topicPath()) }),
+			g.MenuItem("Copy subscription filter").OnClick(func() { g.Context.GetPlatform().SetClipboard(t.subscriptionFilter()) }),
+			g.MenuItem("Pin log to topic").OnClick(func() { pinLog(t.subscriptionFilter()) }),
+			t.tagMenu(),
+		),
+		g.Label(""),
+	}
+	if showGauges() {
+		cells = append(cells, g.Label(""))
+	}
+	return g.TreeTableRow(rowLabel(t.label(), t.name), t.aliasTooltip(cells...)...).Flags(g.TreeNodeFlagsSpanAvailWidth | g.TreeNodeFlagsLeaf)
+}
+
+// readTopics returns the topics listed in r.
+func readTopics(r io.Reader) ([]string, error) {
+	var topics []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		topics = append(topics, line)
+	}
+	return topics, s.Err()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeedTopics(t *testing.T) {
+	resetTree(t)
+	name := filepath.Join(t.TempDir(), "topics")
+	if err := os.WriteFile(name, []byte("# plant\nplant/press/temp\n\n  plant/press/state  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedTopics(name); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, topic := range []string{"plant/press/temp", "plant/press/state"} {
+		n := lookup(topic)
+		if n == nil {
+			t.Fatalf("%s not seeded", topic)
+		}
+		mux.RLock()
+		if n.last != nil || n.messages != 0 || !n.lastSeen.IsZero() || len(n.recent) != 0 {
+			t.Errorf("%s seeded with a message: last %v, %d messages, seen %s, %d recent", topic, n.last, n.messages, n.lastSeen, len(n.recent))
+		}
+		mux.RUnlock()
+	}
+	mux.RLock()
+	if encodingCounts != [numEncodings]int{} {
+		t.Errorf("encoding counts after seeding = %v, want none", encodingCounts)
+	}
+	mux.RUnlock()
+
+	defaultHandler(nil, &forwardedMessage{exportedTopic{Topic: "plant/press/temp", Payload: []byte("80")}})
+	mux.RLock()
+	defer mux.RUnlock()
+	if n := lookupLocked("plant/press/temp"); n.value() != "80" || n.messages != 1 {
+		t.Errorf("after message value = %q, %d messages, want 80, 1 message", n.value(), n.messages)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"strings"
+)
+
+var (
+	unwrapFlag     = flag.Bool("unwrap", false, "show only the value of JSON objects wrapping a single value, such as {\"value\": 23.4}, in the tree")
+	unwrapKeysFlag = flag.String("unwrap-keys", "value,val,v", "comma-separated keys of the objects unwrapped by -unwrap")
+)
+
+// unwrap returns the value of s if it is a JSON object with a single number,
+// string or boolean keyed by one of -unwrap-keys, and -unwrap is given.
+func unwrap(s string, enc encoding) (string, bool) {
+	if !*unwrapFlag || enc != encodingJSON {
+		return "", false
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil || len(obj) != 1 {
+		return "", false
+	}
+
+	for _, key := range strings.Split(*unwrapKeysFlag, ",") {
+		v, ok := obj[strings.TrimSpace(key)]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case json.Number:
+			return v.String(), true
+		case string, bool:
+			var b bytes.Buffer
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				return "", false
+			}
+			return strings.TrimSuffix(b.String(), "\n"), true
+		}
+		return "", false
+	}
+	return "", false
+}
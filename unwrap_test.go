@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestUnwrap(t *testing.T) {
+	defer func() { *unwrapFlag = false }()
+	*unwrapFlag = true
+
+	tests := []struct {
+		payload string
+		want    string
+		ok      bool
+	}{
+		{`{"value": 23.4}`, "23.4", true},
+		{`{"v": "on"}`, `"on"`, true},
+		{`{"val": true}`, "true", true},
+		{`{"value": 1e-7}`, "1e-7", true},
+		{`{"value": 1, "unit": "°C"}`, "", false},
+		{`{"temperature": 23.4}`, "", false},
+		{`{"value": {"a": 1}}`, "", false},
+		{`{"value": null}`, "", false},
+		{`[1]`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := unwrap(tt.payload, encodingJSON)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("unwrap(%s) = %s, %t, want %s, %t", tt.payload, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if _, ok := unwrap(`{"value": 1}`, encodingText); ok {
+		t.Error("unwrapped a payload that wasn't decoded as JSON")
+	}
+	*unwrapFlag = false
+	if _, ok := unwrap(`{"value": 1}`, encodingJSON); ok {
+		t.Error("unwrapped without -unwrap")
+	}
+}
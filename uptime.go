@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+// uptimeTopic is where Mosquitto and compatible brokers publish their uptime,
+// e.g. "12345 seconds".
+const uptimeTopic = "$SYS/broker/uptime"
+
+var uptimeFlag = flag.Bool("uptime", false, "subscribe to "+uptimeTopic+" and show the broker uptime in the window title")
+
+// uptimeAdded is set if withUptime added the subscription to uptimeTopic, so
+// that brokers refusing it are not reported as denying a requested filter.
+var uptimeAdded bool
+
+var (
+	wnd         *g.MasterWindow
+	windowTitle string // the title without uptime
+	shownTitle  string
+)
+
+// withUptime adds uptimeTopic to subs unless a filter already covers it or
+// it is outside -root.
+func withUptime(subs map[string]byte) map[string]byte {
+	if _, ok := belowRoot(uptimeTopic); !ok {
+		return subs
+	}
+	for f := range subs {
+		if matchFilter(f, uptimeTopic) {
+			return subs
+		}
+	}
+	subs[uptimeTopic] = 0
+	uptimeAdded = true
+	return subs
+}
+
+// updateTitle shows the broker uptime in the window title, if known. It must
+// be called from the UI thread with mux held for reading.
+func updateTitle() {
+	title := windowTitle
+	if t := root.find(uptimeTopic); t != nil && t.last != nil {
+		title += " - broker up " + formatUptime(string(t.last.Payload()))
+	}
+	if title != shownTitle {
+		wnd.SetTitle(title)
+		shownTitle = title
+	}
+}
+
+// formatUptime formats an uptime given as "<n> seconds".
+func formatUptime(s string) string {
+	n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(s), " seconds"), 10, 64)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	d := time.Duration(n) * time.Second
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh", days, d/time.Hour)
+	}
+	return fmt.Sprintf("%dh %dm", d/time.Hour, d%time.Hour/time.Minute)
+}
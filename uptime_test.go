@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestFormatUptime(t *testing.T) {
+	tests := map[string]string{
+		"59 seconds":     "0h 0m",
+		"3725 seconds":   "1h 2m",
+		"266400 seconds": "3d 2h",
+		"12345\n":        "3h 25m",
+		"since Monday":   "since Monday",
+	}
+	for in, want := range tests {
+		if got := formatUptime(in); got != want {
+			t.Errorf("formatUptime(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWithUptime(t *testing.T) {
+	if subs := withUptime(map[string]byte{"#": 1}); len(subs) != 2 || subs[uptimeTopic] != 0 {
+		t.Errorf("withUptime(#) = %v, want uptime topic added", subs)
+	}
+	if subs := withUptime(map[string]byte{"$SYS/#": 1}); len(subs) != 1 {
+		t.Errorf("withUptime($SYS/#) = %v, want unchanged", subs)
+	}
+
+	defer func(v string) { *rootFlag = v }(*rootFlag)
+	*rootFlag = "factory"
+	if subs := withUptime(map[string]byte{"factory/#": 1}); len(subs) != 1 {
+		t.Errorf("withUptime(factory/#) below -root factory = %v, want unchanged", subs)
+	}
+}